@@ -9,10 +9,50 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"time"
 )
 
+// RequestObserver is called after each API request made through a
+// PushoverClient with the name of the operation ("login", "register",
+// "download", "delete" or "acknowledge"), how long it took and any resulting
+// error.
+type RequestObserver func(op string, d time.Duration, err error)
+
 type PushoverClient struct {
 	APIURL string
+
+	// Observers are notified of every API request made
+	Observers []RequestObserver
+
+	// Network configures proxies and TLS for the API and the WebSocket
+	Network *Network
+}
+
+func (pc *PushoverClient) observe(op string, start time.Time, err error) {
+	if pc == nil {
+		return
+	}
+
+	d := time.Since(start)
+	for _, o := range pc.Observers {
+		o(op, d, err)
+	}
+}
+
+func (pc *PushoverClient) httpClient() *http.Client {
+	if pc == nil {
+		return nil
+	}
+
+	return pc.Network.HTTPClient()
+}
+
+func (pc *PushoverClient) network() *Network {
+	if pc == nil {
+		return nil
+	}
+
+	return pc.Network
 }
 
 func (pc *PushoverClient) GetApiURL() (url.URL, error) {
@@ -33,7 +73,12 @@ func (pc *PushoverClient) Login(username, password, twofa string) (*LoginRespons
 	if err != nil {
 		return nil, err
 	}
-	return Login(apiURL, username, password, twofa)
+
+	start := time.Now()
+	lr, err := login(pc.httpClient(), apiURL, username, password, twofa)
+	pc.observe("login", start, err)
+
+	return lr, err
 }
 
 func (pc *PushoverClient) Register(secret, name string) (*RegistrationResponse, error) {
@@ -41,7 +86,12 @@ func (pc *PushoverClient) Register(secret, name string) (*RegistrationResponse,
 	if err != nil {
 		return nil, err
 	}
-	return Register(apiURL, secret, name)
+
+	start := time.Now()
+	rr, err := register(pc.httpClient(), apiURL, secret, name)
+	pc.observe("register", start, err)
+
+	return rr, err
 }
 
 type AuthorizedClient struct {
@@ -52,6 +102,8 @@ type AuthorizedClient struct {
 }
 
 func NewAuthorizedClient(userSecret, deviceID string) *AuthorizedClient {
+	DefaultRedactor.Add(userSecret, deviceID)
+
 	return &AuthorizedClient{
 		UserSecret:     userSecret,
 		DeviceID:       deviceID,
@@ -60,19 +112,25 @@ func NewAuthorizedClient(userSecret, deviceID string) *AuthorizedClient {
 }
 
 func (ac *AuthorizedClient) DownloadMessages() (*DownloadResponse, error) {
-	apiURL, err := ac.GetApiURL()
-	if err != nil {
-		return nil, err
-	}
-	return DownloadMessages(apiURL, ac.UserSecret, ac.DeviceID)
+	return ac.PushoverClient.downloadMessages(ac.UserSecret, ac.DeviceID)
 }
 
 func (ac *AuthorizedClient) DeleteMessages(id int64) (*DeleteResponse, error) {
+	return ac.PushoverClient.deleteMessages(ac.UserSecret, ac.DeviceID, id)
+}
+
+// AcknowledgeMessage acknowledges an emergency priority message by its Receipt
+func (ac *AuthorizedClient) AcknowledgeMessage(receipt string) (*AcknowledgeResponse, error) {
 	apiURL, err := ac.GetApiURL()
 	if err != nil {
 		return nil, err
 	}
-	return DeleteMessages(apiURL, ac.UserSecret, ac.DeviceID, id)
+
+	start := time.Now()
+	ar, err := acknowledgeMessage(ac.httpClient(), apiURL, ac.UserSecret, receipt)
+	ac.observe("acknowledge", start, err)
+
+	return ar, err
 }
 
 func (ac *AuthorizedClient) DownloadAndDeleteMessages() (*DownloadResponse, *DeleteResponse, error) {
@@ -83,13 +141,27 @@ func (ac *AuthorizedClient) GetAuthorizedListener(l LeveledLogger) *AuthorizedLi
 	return NewAuthorizedListener(ac, l)
 }
 
+// StatusError is returned when the API responds with a status other than
+// 200 OK
+type StatusError struct {
+	StatusCode int
+
+	msg string
+}
+
+func (e *StatusError) Error() string {
+	return e.msg
+}
+
 // Helper method to make HTTP requests
-func doRequest(method, urlStr string, body io.Reader, headers map[string]string) ([]byte, error) {
-	client := &http.Client{}
+func doRequest(client *http.Client, method, urlStr string, body io.Reader, headers map[string]string) ([]byte, error) {
+	if client == nil {
+		client = &http.Client{}
+	}
 
 	req, err := http.NewRequest(method, urlStr, body)
 	if err != nil {
-		return nil, fmt.Errorf("error creating request: %w", err)
+		return nil, DefaultRedactor.Error(fmt.Errorf("error creating request: %w", err))
 	}
 
 	// Add headers
@@ -99,7 +171,7 @@ func doRequest(method, urlStr string, body io.Reader, headers map[string]string)
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("error fetching request: %w", err)
+		return nil, DefaultRedactor.Error(fmt.Errorf("error fetching request: %w", err))
 	}
 	defer resp.Body.Close()
 
@@ -109,13 +181,22 @@ func doRequest(method, urlStr string, body io.Reader, headers map[string]string)
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("error fetching request: %s - %s", resp.Status, respBody)
+		return nil, &StatusError{
+			StatusCode: resp.StatusCode,
+			msg:        DefaultRedactor.Redact(fmt.Sprintf("error fetching request: %s - %s", resp.Status, respBody)),
+		}
 	}
 
 	return respBody, nil
 }
 
 func Login(api url.URL, username, password, twofa string) (*LoginResponse, error) {
+	return login(nil, api, username, password, twofa)
+}
+
+func login(client *http.Client, api url.URL, username, password, twofa string) (*LoginResponse, error) {
+	DefaultRedactor.Add(password, twofa)
+
 	// Build request body
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
@@ -132,7 +213,7 @@ func Login(api url.URL, username, password, twofa string) (*LoginResponse, error
 
 	api.Path = path.Join(api.Path, "/users/login.json")
 
-	respBody, err := doRequest("POST", api.String(), body, headers)
+	respBody, err := doRequest(client, "POST", api.String(), body, headers)
 	if err != nil {
 		return nil, err
 	}
@@ -142,6 +223,7 @@ func Login(api url.URL, username, password, twofa string) (*LoginResponse, error
 	if err != nil {
 		return nil, fmt.Errorf("error unmarshalling response body: %w", err)
 	}
+	DefaultRedactor.Add(jsonResponse.Secret)
 
 	if !jsonResponse.IsValid() {
 		return jsonResponse, fmt.Errorf("error logging in: %s", jsonResponse.Error())
@@ -151,6 +233,12 @@ func Login(api url.URL, username, password, twofa string) (*LoginResponse, error
 }
 
 func Register(api url.URL, secret, name string) (*RegistrationResponse, error) {
+	return register(nil, api, secret, name)
+}
+
+func register(client *http.Client, api url.URL, secret, name string) (*RegistrationResponse, error) {
+	DefaultRedactor.Add(secret)
+
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
 	writer.WriteField("secret", secret)
@@ -164,7 +252,7 @@ func Register(api url.URL, secret, name string) (*RegistrationResponse, error) {
 
 	api.Path = path.Join(api.Path, "devices.json")
 
-	respBody, err := doRequest("POST", api.String(), body, headers)
+	respBody, err := doRequest(client, "POST", api.String(), body, headers)
 	if err != nil {
 		return nil, err
 	}
@@ -174,6 +262,7 @@ func Register(api url.URL, secret, name string) (*RegistrationResponse, error) {
 	if err != nil {
 		return nil, fmt.Errorf("error unmarshalling response body: %w", err)
 	}
+	DefaultRedactor.Add(jsonResponse.ID)
 
 	if !jsonResponse.IsValid() {
 		return jsonResponse, fmt.Errorf("error registering: %s", jsonResponse.Error())
@@ -183,6 +272,12 @@ func Register(api url.URL, secret, name string) (*RegistrationResponse, error) {
 }
 
 func DownloadMessages(api url.URL, secret, deviceID string) (*DownloadResponse, error) {
+	return downloadMessages(nil, api, secret, deviceID)
+}
+
+func downloadMessages(client *http.Client, api url.URL, secret, deviceID string) (*DownloadResponse, error) {
+	DefaultRedactor.Add(secret, deviceID)
+
 	api.Path = path.Join(api.Path, "messages.json")
 
 	q := api.Query()
@@ -192,7 +287,7 @@ func DownloadMessages(api url.URL, secret, deviceID string) (*DownloadResponse,
 
 	headers := map[string]string{}
 
-	respBody, err := doRequest("GET", api.String(), nil, headers)
+	respBody, err := doRequest(client, "GET", api.String(), nil, headers)
 	if err != nil {
 		return nil, err
 	}
@@ -207,10 +302,20 @@ func DownloadMessages(api url.URL, secret, deviceID string) (*DownloadResponse,
 		return jsonResponse, fmt.Errorf("error downloading: %s", jsonResponse.Error())
 	}
 
+	for i := range jsonResponse.Messages {
+		jsonResponse.Messages[i].QuietHours = jsonResponse.User.QuietHours
+	}
+
 	return jsonResponse, nil
 }
 
 func DeleteMessages(api url.URL, secret, deviceID string, id int64) (*DeleteResponse, error) {
+	return deleteMessages(nil, api, secret, deviceID, id)
+}
+
+func deleteMessages(client *http.Client, api url.URL, secret, deviceID string, id int64) (*DeleteResponse, error) {
+	DefaultRedactor.Add(secret, deviceID)
+
 	body := &bytes.Buffer{}
 	writer := multipart.NewWriter(body)
 	writer.WriteField("secret", secret)
@@ -223,7 +328,7 @@ func DeleteMessages(api url.URL, secret, deviceID string, id int64) (*DeleteResp
 
 	api.Path = path.Join(api.Path, "devices", deviceID, "update_highest_message.json")
 
-	respBody, err := doRequest("POST", api.String(), body, headers)
+	respBody, err := doRequest(client, "POST", api.String(), body, headers)
 	if err != nil {
 		return nil, err
 	}
@@ -241,18 +346,75 @@ func DeleteMessages(api url.URL, secret, deviceID string, id int64) (*DeleteResp
 	return jsonResponse, nil
 }
 
-func (pc *PushoverClient) DownloadAndDeleteMessages(secret, deviceID string) (*DownloadResponse, *DeleteResponse, error) {
+func AcknowledgeMessage(api url.URL, secret, receipt string) (*AcknowledgeResponse, error) {
+	return acknowledgeMessage(nil, api, secret, receipt)
+}
+
+func acknowledgeMessage(client *http.Client, api url.URL, secret, receipt string) (*AcknowledgeResponse, error) {
+	DefaultRedactor.Add(secret)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	writer.WriteField("secret", secret)
+	writer.Close()
+
+	headers := map[string]string{
+		"Content-Type": writer.FormDataContentType(),
+	}
+
+	api.Path = path.Join(api.Path, "receipts", receipt, "acknowledge.json")
+
+	respBody, err := doRequest(client, "POST", api.String(), body, headers)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonResponse := &AcknowledgeResponse{}
+	err = json.Unmarshal(respBody, jsonResponse)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling response body: %w", err)
+	}
+
+	if !jsonResponse.IsValid() {
+		return jsonResponse, fmt.Errorf("error acknowledging message: %s", jsonResponse.Error())
+	}
+
+	return jsonResponse, nil
+}
+
+func (pc *PushoverClient) downloadMessages(secret, deviceID string) (*DownloadResponse, error) {
+	apiURL, err := pc.GetApiURL()
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	dr, err := downloadMessages(pc.httpClient(), apiURL, secret, deviceID)
+	pc.observe("download", start, err)
+
+	return dr, err
+}
+
+func (pc *PushoverClient) deleteMessages(secret, deviceID string, id int64) (*DeleteResponse, error) {
 	apiURL, err := pc.GetApiURL()
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	dr, err := DownloadMessages(apiURL, secret, deviceID)
+	start := time.Now()
+	dm, err := deleteMessages(pc.httpClient(), apiURL, secret, deviceID, id)
+	pc.observe("delete", start, err)
+
+	return dm, err
+}
+
+func (pc *PushoverClient) DownloadAndDeleteMessages(secret, deviceID string) (*DownloadResponse, *DeleteResponse, error) {
+	dr, err := pc.downloadMessages(secret, deviceID)
 	if err != nil {
 		return dr, nil, err
 	}
 
-	dm, err := DeleteMessages(apiURL, secret, deviceID, dr.MaxID())
+	dm, err := pc.deleteMessages(secret, deviceID, dr.MaxID())
 	if err != dr {
 		return dr, dm, err
 	}
@@ -0,0 +1,107 @@
+package pullaway
+
+import (
+	"sync"
+)
+
+// Broadcaster keeps a bounded history of recent messages and fans each newly
+// published message out to any number of subscribers.
+type Broadcaster struct {
+	size int
+
+	mu     sync.Mutex
+	recent []Messages
+	subs   map[chan Messages]struct{}
+}
+
+// NewBroadcaster creates a Broadcaster remembering up to size messages
+func NewBroadcaster(size int) *Broadcaster {
+	return &Broadcaster{
+		size: size,
+		subs: map[chan Messages]struct{}{},
+	}
+}
+
+// Publish records the message and sends a copy to every subscriber. A
+// subscriber whose buffer is full misses the message rather than blocking the
+// publisher. Publish satisfies MessageHandler.
+func (b *Broadcaster) Publish(m *Messages) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.size > 0 {
+		if len(b.recent) >= b.size {
+			b.recent = b.recent[1:]
+		}
+		b.recent = append(b.recent, *m)
+	}
+
+	for c := range b.subs {
+		select {
+		case c <- *m:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// Recent returns the remembered messages, oldest first
+func (b *Broadcaster) Recent() []Messages {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	out := make([]Messages, len(b.recent))
+	copy(out, b.recent)
+
+	return out
+}
+
+// Update calls fn on each remembered message with the given ID, allowing
+// local state such as Acked to be kept current.
+func (b *Broadcaster) Update(id int64, fn func(m *Messages)) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	found := false
+	for i := range b.recent {
+		if b.recent[i].ID == id {
+			fn(&b.recent[i])
+			found = true
+		}
+	}
+
+	return found
+}
+
+// Subscribe returns a channel receiving every message published from now on,
+// along with a function to unsubscribe and close the channel.
+func (b *Broadcaster) Subscribe(buffer int) (<-chan Messages, func()) {
+	return b.SubscribeReplay(buffer, 0)
+}
+
+// SubscribeReplay is like Subscribe but first delivers up to replay of the
+// most recent remembered messages, without gaps or duplicates between them
+// and newly published ones.
+func (b *Broadcaster) SubscribeReplay(buffer, replay int) (<-chan Messages, func()) {
+	b.mu.Lock()
+	replay = max(0, min(replay, len(b.recent)))
+
+	c := make(chan Messages, buffer+replay)
+	for _, m := range b.recent[len(b.recent)-replay:] {
+		c <- m
+	}
+
+	b.subs[c] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return c, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, c)
+			b.mu.Unlock()
+			close(c)
+		})
+	}
+}
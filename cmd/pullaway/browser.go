@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os/exec"
+	"runtime"
+)
+
+// openURL opens an http or https URL in the user's default browser. Other
+// schemes are refused as message URLs come from untrusted senders.
+func openURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("refusing to open URL with scheme %q", u.Scheme)
+	}
+
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", u.String())
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", u.String())
+	default:
+		cmd = exec.Command("xdg-open", u.String())
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	go cmd.Wait()
+
+	return nil
+}
@@ -1,6 +1,17 @@
 package main
 
-import "github.com/99designs/keyring"
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/99designs/keyring"
+)
 
 type ConfigKey string
 
@@ -9,26 +20,162 @@ const (
 	ConfigDeviceID   ConfigKey = "deviceid"
 )
 
+// envKeys maps config keys to the environment variables that override them.
+// Each may also be given as a path to a file by appending _FILE to the name.
+var envKeys = map[ConfigKey]string{
+	ConfigUserSecret: "PULLAWAY_USER_SECRET",
+	ConfigDeviceID:   "PULLAWAY_DEVICE_ID",
+}
+
+// DefaultProfile is the profile used when none is specified. Its keys are
+// stored without a prefix so that existing installs keep working.
+const DefaultProfile = "default"
+
+const profileKeyPrefix = "profile:"
+
+// KeyringPassphraseEnv is the environment variable holding the passphrase of
+// the encrypted file keyring backend. When unset the passphrase is prompted for.
+const KeyringPassphraseEnv = "PULLAWAY_KEYRING_PASSPHRASE"
+
+var profileNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
 type Config struct {
-	keyring keyring.Keyring
+	keyring *lazyKeyring
+	profile string
+
+	// useEnv is set for the profile selected on the command line, so the
+	// environment does not override every profile when listening to several
+	useEnv bool
+
+	File *FileConfig
+}
+
+// lazyKeyring defers opening the keyring until it is first needed, so
+// profiles whose secrets come from elsewhere work without a keyring backend
+type lazyKeyring struct {
+	config keyring.Config
+
+	once sync.Once
+	ring keyring.Keyring
+	err  error
 }
 
-func NewConfig() (*Config, error) {
-	ring, err := keyring.Open(keyring.Config{
-		ServiceName: "com.donatstudios.pullaway",
+func (k *lazyKeyring) get() (keyring.Keyring, error) {
+	k.once.Do(func() {
+		k.ring, k.err = keyring.Open(k.config)
 	})
 
-	if err != nil {
-		return nil, err
+	return k.ring, k.err
+}
+
+// NewConfig creates a Config for the given profile. The keyring backend from
+// the file config is used unless backend is non-empty.
+func NewConfig(profile string, fc *FileConfig, backend string) (*Config, error) {
+	if profile == "" {
+		profile = DefaultProfile
+	}
+
+	if !profileNameRegexp.MatchString(profile) {
+		return nil, fmt.Errorf("invalid profile name %q: only letters, numbers, '-' and '_' are allowed", profile)
+	}
+
+	if fc == nil {
+		fc = &FileConfig{}
+	}
+
+	if backend == "" {
+		backend = fc.Keyring.Backend
+	}
+
+	fileDir := fc.Keyring.FileDir
+	if fileDir == "" {
+		if dir, err := os.UserConfigDir(); err == nil {
+			fileDir = filepath.Join(dir, "pullaway", "keyring")
+		}
+	}
+
+	kc := keyring.Config{
+		ServiceName:      "com.donatstudios.pullaway",
+		FileDir:          fileDir,
+		FilePasswordFunc: keyringPassphrase,
+	}
+
+	if backend != "" {
+		kc.AllowedBackends = []keyring.BackendType{keyring.BackendType(backend)}
 	}
 
 	return &Config{
-		keyring: ring,
+		keyring: &lazyKeyring{config: kc},
+		profile: profile,
+		useEnv:  true,
+		File:    fc,
 	}, nil
 }
 
+// keyringPassphrase reads the file backend passphrase from the environment,
+// falling back to prompting on the terminal
+func keyringPassphrase(prompt string) (string, error) {
+	if p := os.Getenv(KeyringPassphraseEnv); p != "" {
+		return p, nil
+	}
+
+	return keyring.TerminalPrompt(prompt)
+}
+
+// WithProfile returns a Config for the named profile sharing the same keyring
+func (c *Config) WithProfile(profile string) (*Config, error) {
+	if !profileNameRegexp.MatchString(profile) {
+		return nil, fmt.Errorf("invalid profile name %q: only letters, numbers, '-' and '_' are allowed", profile)
+	}
+
+	return &Config{
+		keyring: c.keyring,
+		profile: profile,
+		File:    c.File,
+	}, nil
+}
+
+// Profile returns the name of the profile the Config reads and writes
+func (c *Config) Profile() string {
+	return c.profile
+}
+
+// keyName returns the keyring entry name for the given key in the current profile
+func (c *Config) keyName(key ConfigKey) string {
+	if c.profile == DefaultProfile {
+		return string(key)
+	}
+
+	return profileKeyPrefix + c.profile + ":" + string(key)
+}
+
 func (c *Config) GetKey(key ConfigKey) (string, error) {
-	pass, err := c.keyring.Get(string(key))
+	if c.useEnv {
+		v, err := lookupEnv(envKeys[key])
+		if err != nil || v != "" {
+			return v, err
+		}
+	}
+
+	pc := c.File.Profiles[c.profile]
+	switch key {
+	case ConfigUserSecret:
+		secret, err := pc.resolveSecret()
+		if err != nil || secret != "" {
+			return secret, err
+		}
+	case ConfigDeviceID:
+		if pc.DeviceID != "" {
+			return pc.DeviceID, nil
+		}
+	}
+
+	ring, err := c.keyring.get()
+	if err != nil {
+		return "", err
+	}
+
+	pass, err := ring.Get(c.keyName(key))
 	if err == keyring.ErrKeyNotFound {
 		return "", nil
 	}
@@ -41,8 +188,81 @@ func (c *Config) GetKey(key ConfigKey) (string, error) {
 }
 
 func (c *Config) SetKey(key ConfigKey, value string) error {
-	return c.keyring.Set(keyring.Item{
-		Key:  string(key),
+	ring, err := c.keyring.get()
+	if err != nil {
+		return err
+	}
+
+	return ring.Set(keyring.Item{
+		Key:  c.keyName(key),
 		Data: []byte(value),
 	})
 }
+
+// Profiles returns the sorted names of all profiles with a registered device,
+// either in the keyring or the config file. When the keyring cannot be
+// opened, only the profiles of the config file are returned.
+func (c *Config) Profiles() ([]string, error) {
+	var profiles []string
+	for name, pc := range c.File.Profiles {
+		if pc.DeviceID != "" {
+			profiles = append(profiles, name)
+		}
+	}
+
+	ring, err := c.keyring.get()
+	if err != nil {
+		sort.Strings(profiles)
+		return profiles, nil
+	}
+
+	keys, err := ring.Keys()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, k := range keys {
+		if k == string(ConfigDeviceID) {
+			profiles = append(profiles, DefaultProfile)
+			continue
+		}
+
+		name, ok := strings.CutPrefix(k, profileKeyPrefix)
+		if !ok {
+			continue
+		}
+
+		name, ok = strings.CutSuffix(name, ":"+string(ConfigDeviceID))
+		if ok {
+			profiles = append(profiles, name)
+		}
+	}
+
+	sort.Strings(profiles)
+
+	return slices.Compact(profiles), nil
+}
+
+// lookupEnv returns the value of the named environment variable, or the
+// contents of the file named by its _FILE variant
+func lookupEnv(name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+
+	if v := os.Getenv(name); v != "" {
+		return v, nil
+	}
+
+	path := os.Getenv(name + "_FILE")
+	if path == "" {
+		return "", nil
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("error reading %s_FILE: %w", name, err)
+	}
+
+	return strings.TrimSpace(string(b)), nil
+}
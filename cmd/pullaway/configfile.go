@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/donatj/pullaway"
+)
+
+// FileConfig holds the non-secret settings read from the TOML config file
+type FileConfig struct {
+	APIURL   string `toml:"api_url"`
+	Format   string `toml:"format"`
+	Template string `toml:"template"`
+	// Outputs are written to instead of Format, like repeated -output flags
+	Outputs []string `toml:"outputs"`
+
+	Keyring       KeyringConfig            `toml:"keyring"`
+	Profiles      map[string]ProfileConfig `toml:"profiles"`
+	Notifications NotificationConfig       `toml:"notifications"`
+	Network       NetworkConfig            `toml:"network"`
+}
+
+// NetworkConfig configures proxies and TLS for connections to Pushover
+type NetworkConfig struct {
+	// Proxy is an http://, https:// or socks5:// proxy URL. Empty means the
+	// HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables are used.
+	Proxy string `toml:"proxy"`
+	// CAFile is a PEM file of root certificates to trust instead of the
+	// system roots
+	CAFile string `toml:"ca_file"`
+	// Pins are base64 SHA-256 hashes of public keys, one of which must be in
+	// the certificate chain
+	Pins []string `toml:"pins"`
+}
+
+// NotificationConfig configures the notification output format
+type NotificationConfig struct {
+	// Priorities overrides the notification level used for a message
+	// priority, keyed by priority, e.g. "-1" = "suppress"
+	Priorities map[string]string `toml:"priorities"`
+	// QuietHours is a local do-not-disturb schedule
+	QuietHours QuietHoursConfig `toml:"quiet_hours"`
+}
+
+// QuietHoursConfig limits notifications, other than emergencies, during the
+// Pushover account's quiet hours and a local schedule
+type QuietHoursConfig struct {
+	// Start and End are local times of day such as "22:00". The schedule
+	// runs past midnight when End is before Start.
+	Start string `toml:"start"`
+	End   string `toml:"end"`
+	// Days limits the schedule to the days it starts on, e.g. "sat", "sun".
+	// Empty means every day.
+	Days []string `toml:"days"`
+	// Level is the most prominent notification level used during quiet
+	// hours, "suppress" by default
+	Level string `toml:"level"`
+	// IgnoreAccount disables honoring the quiet hours of the Pushover account
+	IgnoreAccount bool `toml:"ignore_account"`
+}
+
+// KeyringConfig selects and configures the keyring backend
+type KeyringConfig struct {
+	// Backend is one of the 99designs/keyring backend names, e.g. "file",
+	// "secret-service", "keychain" or "pass". Empty means any available.
+	Backend string `toml:"backend"`
+	// FileDir is the directory used by the encrypted file backend
+	FileDir string `toml:"file_dir"`
+}
+
+// ProfileConfig allows the credentials of a profile to be resolved from
+// somewhere other than the keyring
+type ProfileConfig struct {
+	DeviceID   string `toml:"device_id"`
+	SecretEnv  string `toml:"secret_env"`
+	SecretFile string `toml:"secret_file"`
+}
+
+// DefaultConfigPath returns the path of config.toml in the XDG config directory
+func DefaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, "pullaway", "config.toml")
+}
+
+// LoadFileConfig reads the config file at the given path. A missing file
+// results in an empty config rather than an error.
+func LoadFileConfig(path string) (*FileConfig, error) {
+	fc := &FileConfig{}
+	if path == "" {
+		return fc, nil
+	}
+
+	_, err := toml.DecodeFile(path, fc)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fc, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file %s: %w", path, err)
+	}
+
+	return fc, nil
+}
+
+// resolveSecret returns the user secret configured for the profile, or an
+// empty string if it should be read from the keyring
+func (p ProfileConfig) resolveSecret() (string, error) {
+	if p.SecretEnv != "" {
+		if v := os.Getenv(p.SecretEnv); v != "" {
+			return v, nil
+		}
+	}
+
+	if p.SecretFile != "" {
+		b, err := os.ReadFile(p.SecretFile)
+		if err != nil {
+			return "", fmt.Errorf("error reading secret file: %w", err)
+		}
+
+		return strings.TrimSpace(string(b)), nil
+	}
+
+	return "", nil
+}
+
+// network creates the pullaway.Network for the config, or nil when nothing
+// is configured
+func (nc NetworkConfig) network() (*pullaway.Network, error) {
+	if nc.Proxy == "" && nc.CAFile == "" && len(nc.Pins) == 0 {
+		return nil, nil
+	}
+
+	n := &pullaway.Network{Pins: nc.Pins}
+
+	if nc.Proxy != "" {
+		u, err := url.Parse(nc.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		n.Proxy = u
+	}
+
+	if nc.CAFile != "" {
+		pem, err := os.ReadFile(nc.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA file: %w", err)
+		}
+
+		n.RootCAs = x509.NewCertPool()
+		if !n.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", nc.CAFile)
+		}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+
+	"github.com/google/subcommands"
+)
+
+// exitNoMessages is returned by fetch when the request succeeded but there
+// were no pending messages, allowing scripts to distinguish it from failure.
+const exitNoMessages subcommands.ExitStatus = 3
+
+type fetchCmd struct {
+	config *Config
+
+	delete bool
+
+	outputFlags
+}
+
+func (*fetchCmd) Name() string     { return "fetch" }
+func (*fetchCmd) Synopsis() string { return "download pending messages once and exit" }
+func (*fetchCmd) Usage() string {
+	return `fetch [-delete]:
+	download pending messages once and exit
+
+	exits 0 if messages were received, 3 if there were none and 1 on error
+`
+}
+
+func (st *fetchCmd) SetFlags(f *flag.FlagSet) {
+	st.outputFlags.SetFlags(f)
+	f.BoolVar(&st.delete, "delete", false, "Delete the messages from the server after displaying them")
+}
+
+func (st *fetchCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	ac, err := loadAuthorizedClient(st.config)
+	if err != nil {
+		log.Println(err)
+		return subcommands.ExitFailure
+	}
+
+	if ac == nil {
+		log.Println("No authorized client found. Please run 'init' first.")
+		return subcommands.ExitFailure
+	}
+
+	outputs, err := st.initOutputs()
+	if err != nil {
+		log.Printf("Error initializing outputs: %v", err)
+		return subcommands.ExitFailure
+	}
+	defer outputs.Close()
+
+	messages, err := ac.DownloadMessages()
+	if err != nil {
+		log.Printf("Error fetching messages: %v", err)
+		return subcommands.ExitFailure
+	}
+
+	if len(messages.Messages) == 0 {
+		return exitNoMessages
+	}
+
+	for _, m := range messages.Messages {
+		if err := outputs.Handle(&m); err != nil {
+			log.Printf("Error displaying message: %v", err)
+			return subcommands.ExitFailure
+		}
+	}
+
+	if st.delete {
+		_, err := ac.DeleteMessages(messages.MaxID())
+		if err != nil {
+			log.Printf("Error deleting messages: %v", err)
+			return subcommands.ExitFailure
+		}
+	}
+
+	return subcommands.ExitSuccess
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/donatj/pullaway"
+)
+
+// health tracks listener state for liveness and readiness probes
+type health struct {
+	// maxHeartbeatAge is how long after the last heartbeat an account is
+	// still considered ready
+	maxHeartbeatAge time.Duration
+
+	mu            sync.Mutex
+	loggedIn      map[string]bool
+	lastHeartbeat map[string]time.Time
+	fatal         error
+}
+
+func newHealth(maxHeartbeatAge time.Duration) *health {
+	return &health{
+		maxHeartbeatAge: maxHeartbeatAge,
+		loggedIn:        map[string]bool{},
+		lastHeartbeat:   map[string]time.Time{},
+	}
+}
+
+// observeListener is a pullaway.AccountObserver recording connection state
+func (h *health) observeListener(account string, ev pullaway.ListenEvent, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	switch ev {
+	case pullaway.EventLoggedIn:
+		h.loggedIn[account] = true
+		h.lastHeartbeat[account] = time.Now()
+	case pullaway.EventHeartbeat:
+		h.lastHeartbeat[account] = time.Now()
+	case pullaway.EventDisconnected:
+		h.loggedIn[account] = false
+		if errors.Is(err, pullaway.ErrPermanentIssue) || errors.Is(err, pullaway.ErrSessionIssue) {
+			h.fatal = fmt.Errorf("account %s: %w", account, err)
+		}
+	}
+}
+
+// live reports an error once any account has failed in a way reconnecting
+// will not fix
+func (h *health) live() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.fatal
+}
+
+// ready reports an error unless every account is logged in and has seen a
+// heartbeat recently
+func (h *health) ready() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.fatal != nil {
+		return h.fatal
+	}
+
+	if len(h.loggedIn) == 0 {
+		return errors.New("not connected")
+	}
+
+	for account, ok := range h.loggedIn {
+		if !ok {
+			return fmt.Errorf("account %s: not connected", account)
+		}
+
+		if age := time.Since(h.lastHeartbeat[account]); age > h.maxHeartbeatAge {
+			return fmt.Errorf("account %s: last heartbeat %s ago", account, age.Round(time.Second))
+		}
+	}
+
+	return nil
+}
+
+func (h *health) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeProbe(w, h.live())
+}
+
+func (h *health) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	writeProbe(w, h.ready())
+}
+
+func writeProbe(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, err.Error())
+		return
+	}
+
+	fmt.Fprintln(w, "ok")
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/donatj/pullaway"
+)
+
+// APITokenEnv is the environment variable the local API token may be set in
+const APITokenEnv = "PULLAWAY_API_TOKEN"
+
+// messageAPI serves the messages received by listen over a local HTTP API
+type messageAPI struct {
+	b     *pullaway.Broadcaster
+	token string
+	l     pullaway.LeveledLogger
+
+	// acknowledge acknowledges an emergency message with its account's client
+	acknowledge func(m *pullaway.Messages) error
+}
+
+func newMessageAPI(b *pullaway.Broadcaster, token string, acknowledge func(m *pullaway.Messages) error, l pullaway.LeveledLogger) *messageAPI {
+	return &messageAPI{
+		b:           b,
+		token:       token,
+		l:           l,
+		acknowledge: acknowledge,
+	}
+}
+
+func (a *messageAPI) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /messages", a.handleList)
+	mux.HandleFunc("GET /messages/wait", a.handleWait)
+	mux.HandleFunc("GET /messages/stream", a.handleStream)
+	mux.HandleFunc("GET /messages/{id}", a.handleGet)
+	mux.HandleFunc("POST /messages/{id}/ack", a.handleAck)
+
+	return authorize(a.token, mux)
+}
+
+// authorize requires the token as a Bearer Authorization header or, for
+// clients such as EventSource that cannot set headers, a token parameter.
+// An empty token allows every request.
+func authorize(token string, next http.Handler) http.Handler {
+	if token == "" {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			got = r.URL.Query().Get("token")
+		}
+
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			writeAPIError(w, http.StatusUnauthorized, errors.New("invalid or missing token"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleList returns the recent messages, optionally only those with an ID
+// greater than the since parameter
+func (a *messageAPI) handleList(w http.ResponseWriter, r *http.Request) {
+	since, err := parseSince(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, messagesSince(a.b.Recent(), since))
+}
+
+func (a *messageAPI) handleGet(w http.ResponseWriter, r *http.Request) {
+	m, status, err := a.lookup(r)
+	if err != nil {
+		writeAPIError(w, status, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, m)
+}
+
+// handleWait long-polls for messages with an ID greater than since, returning
+// an empty list if none arrive before the timeout parameter (default 30s)
+func (a *messageAPI) handleWait(w http.ResponseWriter, r *http.Request) {
+	since, err := parseSince(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	timeout := 30 * time.Second
+	if t := r.URL.Query().Get("timeout"); t != "" {
+		timeout, err = time.ParseDuration(t)
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, fmt.Errorf("invalid timeout: %w", err))
+			return
+		}
+	}
+
+	// subscribe before checking history so nothing is missed in between
+	c, unsubscribe := a.b.Subscribe(16)
+	defer unsubscribe()
+
+	if ms := messagesSince(a.b.Recent(), since); len(ms) > 0 {
+		writeJSON(w, http.StatusOK, ms)
+		return
+	}
+
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+
+	select {
+	case m := <-c:
+		writeJSON(w, http.StatusOK, []pullaway.Messages{m})
+	case <-t.C:
+		writeJSON(w, http.StatusOK, []pullaway.Messages{})
+	case <-r.Context().Done():
+	}
+}
+
+func (a *messageAPI) handleStream(w http.ResponseWriter, r *http.Request) {
+	serveEvents(w, r, a.b)
+}
+
+// serveEvents sends each message published to b as a Server-Sent Event until
+// the request is done
+func serveEvents(w http.ResponseWriter, r *http.Request, b *pullaway.Broadcaster) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeAPIError(w, http.StatusInternalServerError, errors.New("streaming unsupported"))
+		return
+	}
+
+	c, unsubscribe := b.Subscribe(16)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(30 * time.Second)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case m := <-c:
+			if err := writeEvent(w, &m); err != nil {
+				return
+			}
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+
+		flusher.Flush()
+	}
+}
+
+// handleAck acknowledges an emergency priority message
+func (a *messageAPI) handleAck(w http.ResponseWriter, r *http.Request) {
+	m, status, err := a.lookup(r)
+	if err != nil {
+		writeAPIError(w, status, err)
+		return
+	}
+
+	if m.Receipt == "" {
+		writeAPIError(w, http.StatusBadRequest, errors.New("message has no receipt to acknowledge"))
+		return
+	}
+
+	err = a.acknowledge(m)
+	if err != nil {
+		a.l.Error("error acknowledging message", "id", m.ID, "error", err.Error())
+		writeAPIError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	a.b.Update(m.ID, func(m *pullaway.Messages) {
+		m.Acked = 1
+	})
+	m.Acked = 1
+
+	writeJSON(w, http.StatusOK, m)
+}
+
+// lookup finds the recent message named by the id path parameter
+func (a *messageAPI) lookup(r *http.Request) (*pullaway.Messages, int, error) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("invalid id: %w", err)
+	}
+
+	for _, m := range a.b.Recent() {
+		if m.ID == id {
+			return &m, http.StatusOK, nil
+		}
+	}
+
+	return nil, http.StatusNotFound, fmt.Errorf("message %d not found", id)
+}
+
+func parseSince(r *http.Request) (int64, error) {
+	s := r.URL.Query().Get("since")
+	if s == "" {
+		return 0, nil
+	}
+
+	since, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid since: %w", err)
+	}
+
+	return since, nil
+}
+
+func messagesSince(ms []pullaway.Messages, since int64) []pullaway.Messages {
+	out := []pullaway.Messages{}
+	for _, m := range ms {
+		if m.ID > since {
+			out = append(out, m)
+		}
+	}
+
+	return out
+}
+
+// writeEvent writes a message as a Server-Sent Event
+func writeEvent(w http.ResponseWriter, m *pullaway.Messages) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: message\nid: %d\ndata: %s\n\n", m.ID, data)
+	return err
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -90,7 +90,7 @@ loginLoop:
 		return subcommands.ExitFailure
 	}
 
-	log.Printf("Device Registered: %s\n", shortname)
+	log.Printf("Device Registered: %s (profile: %s)\n", shortname, st.config.Profile())
 
 	return subcommands.ExitSuccess
 }
@@ -1,79 +1,402 @@
 package main
 
 import (
+	"cmp"
 	"context"
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
-	"text/template"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/donatj/pullaway"
-	"github.com/donatj/pullaway/assets"
-	"github.com/gen2brain/beeep"
 	"github.com/google/subcommands"
 )
 
-var iconPath string
+type listenCmd struct {
+	ac *pullaway.AuthorizedClient
+	l  pullaway.LeveledLogger
 
-func init() {
-	tdir, err := os.MkdirTemp("", "pullaway-assets")
-	if err != nil {
-		log.Fatalf("error creating temporary directory: %v", err)
-	}
+	config *Config
 
-	iconPath = filepath.Join(tdir, "pullaway.png")
+	profiles    string
+	daemon      bool
+	metricsAddr string
+	healthAddr  string
+	healthAge   time.Duration
+	apiAddr     string
+	apiToken    string
+	apiHistory  int
 
-	err = os.WriteFile(iconPath, assets.Icon, 0644)
-	if err != nil {
-		log.Fatalf("error writing icon file: %v", err)
-	}
-}
+	relayAddr    string
+	relayOrigins string
 
-type listenCmd struct {
-	ac *pullaway.AuthorizedClient
-	l  pullaway.LeveledLogger
+	socketPath   string
+	socketReplay int
+
+	workers   int
+	queueSize int
+	overflow  string
+	spillDir  string
+	dispatch  pullaway.DispatcherConfig
 
-	format      string
-	templateStr string
+	seenFile string
+	seenSize int
+	seen     pullaway.SeenSet
+
+	mode         string
+	listenMode   pullaway.ListenMode
+	pollInterval time.Duration
+	pollMax      time.Duration
+
+	// observers and requestObservers are attached to every listener and
+	// client by the optional features enabled with flags
+	observers        []pullaway.AccountObserver
+	requestObservers []pullaway.RequestObserver
+	metrics          *metrics
+	api              *messageAPI
+	hub              *pullaway.Broadcaster
+	muxes            map[string]*http.ServeMux
+
+	// clients holds the client of each account being listened to, keyed by
+	// the Account set on its messages
+	clientsMu sync.Mutex
+	clients   map[string]*pullaway.AuthorizedClient
+
+	outputFlags
+
+	// setFlags records the flags given explicitly, which take precedence
+	// over the config file when it is reloaded
+	setFlags map[string]bool
 }
 
 func (*listenCmd) Name() string     { return "listen" }
 func (*listenCmd) Synopsis() string { return "listen for incoming messages" }
 func (*listenCmd) Usage() string {
-	return `listen:
+	return `listen [-daemon]:
 	listen for incoming messages
+
+	with -daemon, readiness and watchdog pings are reported to systemd,
+	SIGTERM/SIGINT stop after in-flight messages are handled and SIGHUP
+	reloads the configuration
 `
 }
 
 func (st *listenCmd) SetFlags(f *flag.FlagSet) {
-	f.StringVar(&st.format, "format", "json", "Output format: json, text, template or notification")
-	f.StringVar(&st.templateStr, "template", "", "Go template for formatting output (used with -format=template)")
+	st.outputFlags.SetFlags(f)
+	f.StringVar(&st.profiles, "profiles", "", "Comma separated list of profiles to listen to concurrently, instead of -profile")
+	f.BoolVar(&st.daemon, "daemon", false, "Run as a service, with systemd notification and signal handling")
+	f.StringVar(&st.metricsAddr, "metrics-addr", "", "Address to serve Prometheus metrics on at /metrics, e.g. localhost:9090")
+	f.StringVar(&st.healthAddr, "health-addr", "", "Address to serve /healthz and /readyz probes on, e.g. localhost:8080")
+	f.DurationVar(&st.healthAge, "health-heartbeat-age", 2*time.Minute, "How recently a heartbeat must have been seen to be ready")
+	f.StringVar(&st.apiAddr, "api-addr", "", "Local address or unix:/path/to/socket to serve the messages API on")
+	f.StringVar(&st.apiToken, "api-token", "", "Token required by the messages API and relay, required unless they are served on a unix socket (env: "+APITokenEnv+")")
+	f.IntVar(&st.apiHistory, "api-history", 100, "Number of recent messages kept for the messages API")
+	f.StringVar(&st.relayAddr, "relay-addr", "", "Address on localhost or a unix socket to re-broadcast messages on as Server-Sent Events at /events and WebSocket at /ws")
+	f.StringVar(&st.relayOrigins, "relay-origins", "", "Comma separated browser origins allowed to subscribe to the relay, or * for any")
+	f.StringVar(&st.socketPath, "socket", "", "Path of a Unix socket to write newline-delimited JSON messages to connected clients on")
+	f.IntVar(&st.socketReplay, "socket-replay", 0, "Number of recent messages to replay to newly connected -socket clients")
+	f.IntVar(&st.workers, "workers", 1, "Number of messages written to the outputs concurrently; messages of the same app stay in order")
+	f.IntVar(&st.queueSize, "queue-size", 100, "Number of messages each worker may have waiting")
+	f.StringVar(&st.overflow, "overflow", "block", "When a worker's queue is full: block, drop-oldest or spill (to -spill-dir)")
+	f.StringVar(&st.spillDir, "spill-dir", "", "Directory for messages spilled with -overflow=spill (default: the temporary directory)")
+	f.StringVar(&st.seenFile, "seen-file", "", "File recording handled messages so none are repeated, even across restarts (default: per profile in the user cache directory)")
+	f.IntVar(&st.seenSize, "seen-size", 1000, "Number of recent messages remembered to skip duplicates, 0 to disable")
+	f.StringVar(&st.mode, "mode", "auto", "How to learn of new messages: ws (WebSocket), poll, or auto to poll while the WebSocket is unreachable")
+	f.DurationVar(&st.pollInterval, "poll-interval", 30*time.Second, "Time between polls after messages were found")
+	f.DurationVar(&st.pollMax, "poll-max-interval", 90*time.Second, "Time between polls grows to this while idle")
 }
 
-func (st *listenCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
-	if st.ac == nil {
-		log.Println("No authorized client found. Please run 'init' first.")
+func (st *listenCmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	st.setFlags = map[string]bool{}
+	f.Visit(func(fl *flag.Flag) {
+		st.setFlags[fl.Name] = true
+	})
+
+	// read here rather than as the flag default, which help would print
+	st.apiToken = cmp.Or(st.apiToken, os.Getenv(APITokenEnv))
+
+	var err error
+	st.listenMode, err = pullaway.ParseListenMode(st.mode)
+	if err != nil {
+		log.Printf("Invalid -mode: %v", err)
+		return subcommands.ExitUsageError
+	}
+
+	policy, err := pullaway.ParseOverflowPolicy(st.overflow)
+	if err != nil {
+		log.Printf("Invalid -overflow: %v", err)
+		return subcommands.ExitUsageError
+	}
+
+	st.dispatch = pullaway.DispatcherConfig{
+		Workers:   st.workers,
+		QueueSize: st.queueSize,
+		Policy:    policy,
+		SpillDir:  st.spillDir,
+	}
+
+	// -profiles loads a client for each profile instead
+	if st.profiles == "" {
+		st.ac, err = loadAuthorizedClient(st.config)
+		if err != nil {
+			log.Println(err)
+			return subcommands.ExitFailure
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if st.metricsAddr != "" {
+		st.metrics = newMetrics()
+		st.observers = append(st.observers, st.metrics.observeListener)
+		st.requestObservers = append(st.requestObservers, st.metrics.observeRequest)
+
+		st.handle(st.metricsAddr, "/metrics", st.metrics)
+	}
+
+	if st.healthAddr != "" {
+		h := newHealth(st.healthAge)
+		st.observers = append(st.observers, h.observeListener)
+
+		st.handle(st.healthAddr, "/healthz", http.HandlerFunc(h.handleHealthz))
+		st.handle(st.healthAddr, "/readyz", http.HandlerFunc(h.handleReadyz))
+	}
+
+	if st.apiAddr != "" {
+		if !isLocalAddr(st.apiAddr) {
+			log.Printf("The messages API must be served on localhost or a unix socket, not %s", st.apiAddr)
+			return subcommands.ExitFailure
+		}
+
+		if st.apiToken == "" && !strings.HasPrefix(st.apiAddr, "unix:") {
+			log.Println("An -api-token is required when serving the messages API over TCP")
+			return subcommands.ExitFailure
+		}
+
+		st.api = newMessageAPI(st.broadcaster(), st.apiToken, st.acknowledge, st.l)
+		routes := st.api.routes()
+		st.handle(st.apiAddr, "/messages", routes)
+		st.handle(st.apiAddr, "/messages/", routes)
+	}
+
+	if st.relayAddr != "" {
+		if !isLocalAddr(st.relayAddr) {
+			log.Printf("The relay must be served on localhost or a unix socket, not %s", st.relayAddr)
+			return subcommands.ExitFailure
+		}
+
+		if st.apiToken == "" && !strings.HasPrefix(st.relayAddr, "unix:") {
+			log.Println("An -api-token is required when serving the relay over TCP")
+			return subcommands.ExitFailure
+		}
+
+		rl := &relay{
+			b:     st.broadcaster(),
+			token: st.apiToken,
+			l:     st.l,
+		}
+		if st.relayOrigins != "" {
+			rl.origins = strings.Split(st.relayOrigins, ",")
+		}
+
+		routes := rl.routes()
+		st.handle(st.relayAddr, "/events", routes)
+		st.handle(st.relayAddr, "/ws", routes)
+	}
+
+	if st.socketPath != "" {
+		if err := serveSocket(ctx, st.socketPath, st.broadcaster(), st.socketReplay, st.l); err != nil {
+			log.Printf("Error listening on socket: %v", err)
+			return subcommands.ExitFailure
+		}
+	}
+
+	for addr, mux := range st.muxes {
+		if err := serveHTTP(ctx, addr, mux, st.l); err != nil {
+			log.Println(err)
+			return subcommands.ExitFailure
+		}
+	}
+
+	if st.seenSize > 0 {
+		seen, err := st.openSeenSet()
+		if err != nil {
+			log.Printf("Error opening seen messages: %v", err)
+			return subcommands.ExitFailure
+		}
+		defer seen.Close()
+
+		st.seen = seen
+	}
+
+	if st.daemon {
+		st.observers = append(st.observers, daemonObserver)
+		return st.executeDaemon(ctx)
+	}
+
+	return st.listen(ctx)
+}
+
+// openSeenSet opens the -seen-file, defaulting to a file per profile in the
+// user cache directory
+func (st *listenCmd) openSeenSet() (*pullaway.FileSeenSet, error) {
+	path := st.seenFile
+	if path == "" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, err
+		}
+
+		name := st.config.Profile()
+		if st.profiles != "" {
+			name = strings.ReplaceAll(st.profiles, ",", "+")
+		}
+
+		path = filepath.Join(dir, "pullaway", "seen-"+name)
+	}
+
+	return pullaway.OpenFileSeenSet(path, st.seenSize, st.l)
+}
+
+// handle registers an HTTP handler to be served on addr, sharing a server
+// between features configured with the same address
+func (st *listenCmd) handle(addr, pattern string, handler http.Handler) {
+	if st.muxes == nil {
+		st.muxes = map[string]*http.ServeMux{}
+	}
+
+	mux, ok := st.muxes[addr]
+	if !ok {
+		mux = http.NewServeMux()
+		st.muxes[addr] = mux
+	}
+
+	mux.Handle(pattern, handler)
+}
+
+// setClient records the client used for messages of the given account
+func (st *listenCmd) setClient(account string, ac *pullaway.AuthorizedClient) {
+	st.clientsMu.Lock()
+	defer st.clientsMu.Unlock()
+
+	if st.clients == nil {
+		st.clients = map[string]*pullaway.AuthorizedClient{}
+	}
+
+	st.clients[account] = ac
+}
+
+// acknowledge acknowledges an emergency priority message using the client of
+// the account it was received on
+func (st *listenCmd) acknowledge(m *pullaway.Messages) error {
+	st.clientsMu.Lock()
+	ac := st.clients[m.Account]
+	st.clientsMu.Unlock()
+
+	if ac == nil {
+		return fmt.Errorf("no client for account %q", m.Account)
+	}
+
+	_, err := ac.AcknowledgeMessage(m.Receipt)
+	return err
+}
+
+// broadcaster returns the Broadcaster shared by the features serving received
+// messages, creating it on first use
+func (st *listenCmd) broadcaster() *pullaway.Broadcaster {
+	if st.hub == nil {
+		st.hub = pullaway.NewBroadcaster(max(st.apiHistory, st.socketReplay))
+	}
+
+	return st.hub
+}
+
+// publishing is middleware that also publishes each message to b
+func publishing(b *pullaway.Broadcaster) pullaway.Middleware {
+	return func(next pullaway.MessageHandler) pullaway.MessageHandler {
+		return func(m *pullaway.Messages) error {
+			_ = b.Publish(m)
+			return next(m)
+		}
+	}
+}
+
+// listen listens until ctx is done or listening fails permanently
+func (st *listenCmd) listen(ctx context.Context) subcommands.ExitStatus {
+	st.outputFlags.acknowledge = st.acknowledge
+
+	outputs, err := st.initOutputs()
+	if err != nil {
+		log.Printf("Error initializing outputs: %v", err)
 		return subcommands.ExitFailure
 	}
+	defer outputs.Close()
+
+	// writing to the outputs happens on workers so slow outputs do not hold
+	// up the listener, which waits for them on return
+	write := pullaway.Chain(outputs.Handle, pullaway.Logging(st.l), pullaway.Recover())
+	dispatcher := pullaway.NewDispatcher(write, st.dispatch, st.l)
+	defer dispatcher.Close()
+
+	// the middleware runs on the listening goroutines
+	mw := []pullaway.Middleware{pullaway.Recover()}
+
+	if st.seen != nil {
+		mw = append(mw, pullaway.DedupeWith(st.seen))
+	}
+
+	if st.hub != nil {
+		mw = append(mw, publishing(st.hub))
+	}
+
+	if st.metrics != nil {
+		mw = append(mw, st.metrics.countMessages(st.config.Profile()))
+	}
+
+	displayFunc := pullaway.Chain(dispatcher.Handle, mw...)
+
+	if st.profiles != "" {
+		err = st.listenProfiles(ctx, displayFunc)
+	} else {
+		err = st.listenProfile(ctx, displayFunc)
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return subcommands.ExitSuccess
+	}
 
-	// Initialize the display function based on the format
-	displayFunc, err := st.initDisplayFunc()
 	if err != nil {
-		log.Printf("Error initializing display function: %v", err)
+		log.Printf("Error listening: %v", err)
 		return subcommands.ExitFailure
 	}
 
-	downloadAndDisplay := func() error {
-		messages, _, err := st.ac.DownloadAndDeleteMessages()
-		if err != nil {
-			st.l.Error("error fetching messages", "error", err.Error())
-			return nil
+	return subcommands.ExitSuccess
+}
+
+// listenProfile listens to the profile selected with -profile
+func (st *listenCmd) listenProfile(ctx context.Context, displayFunc pullaway.MessageHandler) error {
+	if st.ac == nil {
+		return errors.New("no authorized client found. Please run 'init' first")
+	}
+
+	st.ac.Observers = st.requestObservers
+	st.setClient("", st.ac)
+
+	display := func(dr *pullaway.DownloadResponse) error {
+		if _, err := st.ac.DeleteMessages(dr.MaxID()); err != nil {
+			st.l.Error("error deleting messages", "error", err.Error())
 		}
 
-		for _, m := range messages.Messages {
+		for _, m := range dr.Messages {
 			if err := displayFunc(&m); err != nil {
 				return err
 			}
@@ -82,76 +405,154 @@ func (st *listenCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{
 		return nil
 	}
 
-	// ignore any initial errors, just start listening
-	_ = downloadAndDisplay()
+	downloadAndDisplay := func() error {
+		dr, err := st.ac.DownloadMessages()
+		if err != nil {
+			st.l.Error("error fetching messages", "error", err.Error())
+			return nil
+		}
+
+		return display(dr)
+	}
 
 	// Start listening for new messages
 	listener := st.ac.GetAuthorizedListener(st.l)
-
-	err = listener.ListenWithReconnect(downloadAndDisplay)
-	if err != nil {
-		log.Printf("Error listening: %v", err)
-		return subcommands.ExitFailure
+	listener.Mode = st.listenMode
+	listener.Poll = st.pollConfig()
+	listener.Polled = display
+	for _, o := range st.observers {
+		listener.Observers = append(listener.Observers, func(ev pullaway.ListenEvent, err error) {
+			o(st.config.Profile(), ev, err)
+		})
 	}
 
-	return subcommands.ExitSuccess
+	return listener.ListenWithReconnectContext(ctx, downloadAndDisplay)
+}
+
+func (st *listenCmd) pollConfig() pullaway.PollConfig {
+	return pullaway.PollConfig{
+		Interval:    st.pollInterval,
+		MaxInterval: st.pollMax,
+	}
 }
 
-// initDisplayFunc returns the appropriate display function based on the format
-func (st *listenCmd) initDisplayFunc() (func(*pullaway.Messages) error, error) {
-	switch st.format {
-	case "json":
-		return displayMessageJSON, nil
-	case "text":
-		return displayMessageText, nil
-	case "notification":
-		return displayMessageNotification, nil
-	case "template":
-		if st.templateStr == "" {
-			return nil, fmt.Errorf("template string must be provided when format is 'template'")
-		}
-		// Compile the template once
-		tmpl, err := template.New("output").Parse(st.templateStr)
+// listenProfiles listens to each of the profiles given by -profiles,
+// merging their messages into a single output stream
+func (st *listenCmd) listenProfiles(ctx context.Context, displayFunc pullaway.MessageHandler) error {
+	sup := pullaway.NewSupervisor(st.l)
+	sup.Observers = st.observers
+	sup.Mode = st.listenMode
+	sup.Poll = st.pollConfig()
+
+	for _, name := range strings.Split(st.profiles, ",") {
+		name = strings.TrimSpace(name)
+
+		pcfg, err := st.config.WithProfile(name)
+		if err != nil {
+			return err
+		}
+
+		ac, err := loadAuthorizedClient(pcfg)
 		if err != nil {
-			return nil, fmt.Errorf("error parsing template: %w", err)
+			return err
 		}
-		return displayMessageTemplate(tmpl), nil
-	default:
-		return nil, fmt.Errorf("unknown format: %s", st.format)
+
+		if ac == nil {
+			return fmt.Errorf("profile %s is not initialized. Please run 'init' first", name)
+		}
+
+		ac.Observers = st.requestObservers
+		st.setClient(name, ac)
+
+		sup.Add(name, ac)
 	}
+
+	return sup.RunContext(ctx, displayFunc)
 }
 
-// displayMessageJSON outputs a single message in JSON format
-func displayMessageJSON(m *pullaway.Messages) error {
-	if err := json.NewEncoder(os.Stdout).Encode(m); err != nil {
-		return fmt.Errorf("error encoding JSON: %w", err)
+// executeDaemon listens until SIGTERM or SIGINT, restarting the listener with
+// a freshly loaded configuration on SIGHUP
+func (st *listenCmd) executeDaemon(ctx context.Context) subcommands.ExitStatus {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	defer signal.Stop(sigs)
+
+	for {
+		runCtx, cancel := context.WithCancel(ctx)
+		done := make(chan subcommands.ExitStatus, 1)
+		go func() {
+			done <- st.listen(runCtx)
+		}()
+
+		select {
+		case status := <-done:
+			cancel()
+			return status
+		case sig := <-sigs:
+			if sig != syscall.SIGHUP {
+				st.l.Info("shutting down", "signal", sig.String())
+				_ = sdNotify("STOPPING=1")
+				cancel()
+				return <-done
+			}
+
+			st.l.Info("reloading configuration")
+			_ = sdNotify("RELOADING=1")
+			cancel()
+			<-done
+
+			if err := st.reload(); err != nil {
+				st.l.Error("error reloading configuration, keeping previous", "error", err.Error())
+			}
+		}
 	}
-	return nil
 }
 
-// displayMessageText outputs a single message in a simple text format
-func displayMessageText(m *pullaway.Messages) error {
-	fmt.Printf("From %s: %s - %s", m.App, m.Title, m.Message)
-	if m.URL != "" {
-		fmt.Printf(" - URL: %s", m.URL)
+// reload re-reads the config file and credentials. Flags given on the
+// command line keep precedence over the file.
+func (st *listenCmd) reload() error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
 	}
-	fmt.Println()
 
-	return nil
-}
+	var ac *pullaway.AuthorizedClient
+	if st.profiles == "" {
+		ac, err = loadAuthorizedClient(cfg)
+		if err != nil {
+			return err
+		}
+	}
+
+	st.config = cfg
+	st.ac = ac
 
-func displayMessageNotification(m *pullaway.Messages) error {
-	beeep.Notify(fmt.Sprintf("%s: %s", m.App, m.Title), m.Message, iconPath)
+	if !st.setFlags["format"] {
+		st.format = cmp.Or(cfg.File.Format, "json")
+	}
+
+	if !st.setFlags["template"] {
+		st.templateStr = cfg.File.Template
+	}
+
+	if !st.setFlags["output"] {
+		st.outputs = outputList{values: cfg.File.Outputs}
+	}
+
+	st.notifications = cfg.File.Notifications
 
 	return nil
 }
 
-// displayMessageTemplate returns a function that outputs a single message using the provided template
-func displayMessageTemplate(tmpl *template.Template) func(*pullaway.Messages) error {
-	return func(m *pullaway.Messages) error {
-		if err := tmpl.Execute(os.Stdout, m); err != nil {
-			return fmt.Errorf("error executing template: %w", err)
-		}
-		return nil
+// daemonObserver reports the listener state to systemd, sending watchdog
+// pings on each heartbeat
+func daemonObserver(account string, ev pullaway.ListenEvent, err error) {
+	switch ev {
+	case pullaway.EventLoggedIn:
+		_ = sdNotify("READY=1\nSTATUS=Listening")
+	case pullaway.EventHeartbeat:
+		_ = sdNotify("WATCHDOG=1")
+	case pullaway.EventDisconnected:
+		_ = sdNotify("STATUS=Disconnected")
 	}
 }
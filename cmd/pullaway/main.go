@@ -3,49 +3,125 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
-	"log/slog"
 	"os"
 
 	"github.com/donatj/pullaway"
 	"github.com/google/subcommands"
 )
 
+var (
+	profile        = flag.String("profile", DefaultProfile, "Name of the profile to use")
+	configPath     = flag.String("config", DefaultConfigPath(), "Path to the TOML config file")
+	keyringBackend = flag.String("keyring-backend", "", "Keyring backend to use: secret-service, keychain, kwallet, wincred, pass, keyctl or file (default: first available)")
+
+	logLevel      = flag.String("log-level", "info", "Minimum level of log messages: debug, info, warn or error")
+	logFormat     = flag.String("log-format", "text", "Format of log messages: text or json")
+	logFile       = flag.String("log-file", "", "File to append log messages to instead of stderr, rotated by size")
+	logMaxSize    = flag.Int64("log-max-size", 10, "Size in megabytes at which -log-file is rotated")
+	logMaxBackups = flag.Int("log-max-backups", 3, "Number of rotated -log-file backups to keep")
+)
+
 func main() {
-	pc := &pullaway.PushoverClient{}
+	log.SetOutput(redactingWriter{os.Stderr})
+	defer exitOnPanic()
+
+	subcommands.ImportantFlag("profile")
+	flag.Parse()
 
-	cfg, err := NewConfig()
+	cfg, err := loadConfig()
 	if err != nil {
-		log.Fatalf("Error creating config: %v", err)
+		log.Fatal(err)
 	}
 
+	fc := cfg.File
+	network, err := fc.Network.network()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	pc := &pullaway.PushoverClient{APIURL: fc.APIURL, Network: network}
+
 	subcommands.Register(&initCmd{pc, cfg}, "initial setup")
+	subcommands.Register(&profilesCmd{cfg}, "")
+
+	l, logCloser, err := newLogger(*logLevel, *logFormat, *logFile, *logMaxSize<<20, *logMaxBackups)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	output := outputFlags{
+		format:        fc.Format,
+		templateStr:   fc.Template,
+		outputs:       outputList{values: fc.Outputs},
+		notifications: fc.Notifications,
+		l:             l,
+	}
+
+	subcommands.Register(&listenCmd{
+		l:           l,
+		config:      cfg,
+		outputFlags: output,
+	}, "")
 
+	subcommands.Register(&tuiCmd{
+		config: cfg,
+	}, "")
+
+	subcommands.Register(&fetchCmd{
+		config:      cfg,
+		outputFlags: output,
+	}, "")
+
+	ctx := context.Background()
+	status := subcommands.Execute(ctx)
+
+	logCloser.Close()
+	os.Exit(int(status))
+}
+
+// loadConfig reads the config file and creates the Config for the profile
+// selected on the command line
+func loadConfig() (*Config, error) {
+	fc, err := LoadFileConfig(*configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := NewConfig(*profile, fc, *keyringBackend)
+	if err != nil {
+		return nil, fmt.Errorf("error creating config: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// loadAuthorizedClient returns a client for the profile of the given config,
+// or nil if the profile has not been initialized
+func loadAuthorizedClient(cfg *Config) (*pullaway.AuthorizedClient, error) {
 	secret, err := cfg.GetKey(ConfigUserSecret)
 	if err != nil {
-		log.Fatalf("Error getting secret from config: %v", err)
+		return nil, fmt.Errorf("error getting secret from config: %w", err)
 	}
 
 	deviceID, err := cfg.GetKey(ConfigDeviceID)
 	if err != nil {
-		log.Fatalf("Error getting device ID from config: %v", err)
+		return nil, fmt.Errorf("error getting device ID from config: %w", err)
 	}
 
-	var ac *pullaway.AuthorizedClient
-	if secret != "" && deviceID != "" {
-		ac = pullaway.NewAuthorizedClient(secret, deviceID)
+	if secret == "" || deviceID == "" {
+		return nil, nil
 	}
 
-	l := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
-		Level: slog.LevelInfo,
-	}))
+	network, err := cfg.File.Network.network()
+	if err != nil {
+		return nil, err
+	}
 
-	subcommands.Register(&listenCmd{
-		ac: ac,
-		l:  l,
-	}, "")
+	ac := pullaway.NewAuthorizedClient(secret, deviceID)
+	ac.APIURL = cfg.File.APIURL
+	ac.Network = network
 
-	flag.Parse()
-	ctx := context.Background()
-	os.Exit(int(subcommands.Execute(ctx)))
+	return ac, nil
 }
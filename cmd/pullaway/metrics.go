@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/donatj/pullaway"
+)
+
+// metrics collects listener statistics and serves them in the Prometheus
+// text exposition format
+type metrics struct {
+	mu sync.Mutex
+
+	received       map[[3]string]float64 // account, app, priority
+	requests       map[string]float64    // op
+	requestSeconds map[string]float64    // op
+	requestErrors  map[string]float64    // op
+	reconnects     map[[2]string]float64 // account, reason
+	up             map[string]bool       // account
+	lastHeartbeat  map[string]time.Time  // account
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		received:       map[[3]string]float64{},
+		requests:       map[string]float64{},
+		requestSeconds: map[string]float64{},
+		requestErrors:  map[string]float64{},
+		reconnects:     map[[2]string]float64{},
+		up:             map[string]bool{},
+		lastHeartbeat:  map[string]time.Time{},
+	}
+}
+
+// observeRequest is a pullaway.RequestObserver recording API latency and errors
+func (m *metrics) observeRequest(op string, d time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[op]++
+	m.requestSeconds[op] += d.Seconds()
+	if err != nil {
+		m.requestErrors[op]++
+	}
+}
+
+// observeListener is a pullaway.AccountObserver recording connection state
+func (m *metrics) observeListener(account string, ev pullaway.ListenEvent, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch ev {
+	case pullaway.EventLoggedIn:
+		m.up[account] = true
+	case pullaway.EventHeartbeat:
+		m.lastHeartbeat[account] = time.Now()
+	case pullaway.EventDisconnected:
+		m.up[account] = false
+		if !errors.Is(err, context.Canceled) {
+			m.reconnects[[2]string{account, reconnectReason(err)}]++
+		}
+	}
+}
+
+// countMessages is middleware counting each message delivered through it.
+// Messages without an Account, as when listening to a single profile, are
+// counted under account so they match the connection metrics.
+func (m *metrics) countMessages(account string) pullaway.Middleware {
+	return func(next pullaway.MessageHandler) pullaway.MessageHandler {
+		return func(msg *pullaway.Messages) error {
+			a := msg.Account
+			if a == "" {
+				a = account
+			}
+
+			m.mu.Lock()
+			m.received[[3]string{a, msg.App, strconv.Itoa(msg.Priority)}]++
+			m.mu.Unlock()
+
+			return next(msg)
+		}
+	}
+}
+
+// reconnectReason classifies the error a listener disconnected with
+func reconnectReason(err error) string {
+	switch {
+	case errors.Is(err, pullaway.ErrNeedReconnect):
+		return "reconnect_requested"
+	case errors.Is(err, pullaway.ErrPermanentIssue):
+		return "permanent_issue"
+	case errors.Is(err, pullaway.ErrSessionIssue):
+		return "session_issue"
+	case errors.Is(err, pullaway.ErrWebsocketConnectFail):
+		return "connect_failed"
+	case errors.Is(err, pullaway.ErrWebsocketLoginFail):
+		return "login_failed"
+	case errors.Is(err, pullaway.ErrWebsocketReadFail):
+		return "read_failed"
+	case errors.Is(err, pullaway.ErrRetryWebSocket):
+		return "websocket_retry"
+	default:
+		return "handler_error"
+	}
+}
+
+func (m *metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+
+	writeHeader(w, "pullaway_messages_received_total", "counter", "Messages received, by account, app and priority.")
+	for _, k := range sortedKeys(m.received) {
+		writeSample(w, "pullaway_messages_received_total", m.received[k], "account", k[0], "app", k[1], "priority", k[2])
+	}
+
+	writeHeader(w, "pullaway_api_request_duration_seconds", "summary", "Duration of Pushover API requests, by operation.")
+	for _, op := range sortedKeys(m.requests) {
+		writeSample(w, "pullaway_api_request_duration_seconds_sum", m.requestSeconds[op], "op", op)
+		writeSample(w, "pullaway_api_request_duration_seconds_count", m.requests[op], "op", op)
+	}
+
+	writeHeader(w, "pullaway_api_request_errors_total", "counter", "Failed Pushover API requests, by operation.")
+	for _, op := range sortedKeys(m.requestErrors) {
+		writeSample(w, "pullaway_api_request_errors_total", m.requestErrors[op], "op", op)
+	}
+
+	writeHeader(w, "pullaway_reconnects_total", "counter", "WebSocket disconnections, by account and reason.")
+	for _, k := range sortedKeys(m.reconnects) {
+		writeSample(w, "pullaway_reconnects_total", m.reconnects[k], "account", k[0], "reason", k[1])
+	}
+
+	writeHeader(w, "pullaway_connection_up", "gauge", "Whether the WebSocket is connected and logged in, by account.")
+	for _, a := range sortedKeys(m.up) {
+		v := 0.0
+		if m.up[a] {
+			v = 1
+		}
+		writeSample(w, "pullaway_connection_up", v, "account", a)
+	}
+
+	writeHeader(w, "pullaway_heartbeat_age_seconds", "gauge", "Seconds since the last WebSocket heartbeat, by account.")
+	for _, a := range sortedKeys(m.lastHeartbeat) {
+		writeSample(w, "pullaway_heartbeat_age_seconds", now.Sub(m.lastHeartbeat[a]).Seconds(), "account", a)
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func writeHeader(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// writeSample writes a single sample line with the given label name/value pairs
+func writeSample(w io.Writer, name string, v float64, labels ...string) {
+	var lb strings.Builder
+	for i := 0; i+1 < len(labels); i += 2 {
+		if lb.Len() > 0 {
+			lb.WriteByte(',')
+		}
+		fmt.Fprintf(&lb, `%s="%s"`, labels[i], labelEscaper.Replace(labels[i+1]))
+	}
+
+	fmt.Fprintf(w, "%s{%s} %s\n", name, lb.String(), strconv.FormatFloat(v, 'g', -1, 64))
+}
+
+func sortedKeys[K [2]string | [3]string | string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+	})
+
+	return keys
+}
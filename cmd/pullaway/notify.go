@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/donatj/pullaway"
+)
+
+// notifyLevel is how prominently a message is shown as a desktop notification
+type notifyLevel string
+
+const (
+	notifySuppress   notifyLevel = "suppress"
+	notifyQuiet      notifyLevel = "quiet"
+	notifyNormal     notifyLevel = "normal"
+	notifyUrgent     notifyLevel = "urgent"
+	notifyPersistent notifyLevel = "persistent"
+)
+
+// defaultNotifyLevels maps Pushover message priorities to notification levels
+var defaultNotifyLevels = map[int]notifyLevel{
+	-2: notifySuppress,
+	-1: notifyQuiet,
+	0:  notifyNormal,
+	1:  notifyUrgent,
+	2:  notifyPersistent,
+}
+
+// notifier displays messages as desktop notifications according to priority
+type notifier struct {
+	levels map[int]notifyLevel
+	quiet  *quietHours
+
+	acknowledge func(m *pullaway.Messages) error
+	log         pullaway.LeveledLogger
+}
+
+func newNotifier(nc NotificationConfig, acknowledge func(m *pullaway.Messages) error, logger pullaway.LeveledLogger) (*notifier, error) {
+	if logger == nil {
+		logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+
+	levels := map[int]notifyLevel{}
+	for p, l := range defaultNotifyLevels {
+		levels[p] = l
+	}
+
+	for key, value := range nc.Priorities {
+		p, err := strconv.Atoi(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid notification priority %q: %w", key, err)
+		}
+
+		l := notifyLevel(value)
+		switch l {
+		case notifySuppress, notifyQuiet, notifyNormal, notifyUrgent, notifyPersistent:
+		default:
+			return nil, fmt.Errorf("invalid notification level %q for priority %d", value, p)
+		}
+
+		levels[p] = l
+	}
+
+	quiet, err := newQuietHours(nc.QuietHours)
+	if err != nil {
+		return nil, err
+	}
+
+	return &notifier{
+		levels:      levels,
+		quiet:       quiet,
+		acknowledge: acknowledge,
+		log:         logger,
+	}, nil
+}
+
+// level returns the notification level for a message priority
+func (n *notifier) level(priority int) notifyLevel {
+	if l, ok := n.levels[priority]; ok {
+		return l
+	}
+
+	// priorities outside the known range are clamped
+	if priority > 2 {
+		return n.levels[2]
+	}
+	return n.levels[-2]
+}
+
+func (n *notifier) display(m *pullaway.Messages) error {
+	l := n.quiet.limit(m, n.level(m.Priority), time.Now())
+	if l == notifySuppress {
+		return nil
+	}
+
+	return n.send(m, l)
+}
+
+// notificationTitle returns the summary line of a message's notification
+func notificationTitle(m *pullaway.Messages) string {
+	return fmt.Sprintf("%s: %s", m.App, m.Title)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/donatj/pullaway"
+	"github.com/gen2brain/beeep"
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	notificationsInterface = "org.freedesktop.Notifications"
+	notificationsPath      = "/org/freedesktop/Notifications"
+)
+
+// freedesktop notification urgency hint values
+var notifyUrgencies = map[notifyLevel]byte{
+	notifyQuiet:      0,
+	notifyNormal:     1,
+	notifyUrgent:     2,
+	notifyPersistent: 2,
+}
+
+// notificationActions holds the action handlers of notifications still on
+// screen, keyed by notification ID
+var notificationActions = struct {
+	sync.Mutex
+	once     sync.Once
+	handlers map[uint32]func(action string)
+}{
+	handlers: map[uint32]func(action string){},
+}
+
+// send shows a notification via org.freedesktop.Notifications with an urgency
+// hint and actions to open the message URL or acknowledge an emergency,
+// falling back to beeep if D-Bus is unavailable
+func (n *notifier) send(m *pullaway.Messages, l notifyLevel) error {
+	title := notificationTitle(m)
+
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return beeep.Notify(title, m.Message, iconPath)
+	}
+
+	hints := map[string]dbus.Variant{
+		"urgency": dbus.MakeVariant(notifyUrgencies[l]),
+	}
+
+	// -1 lets the server decide, 0 never expires
+	expire := int32(-1)
+	if l == notifyPersistent {
+		expire = 0
+	}
+
+	actions, handler := n.actions(m)
+
+	obj := conn.Object(notificationsInterface, notificationsPath)
+	call := obj.Call(notificationsInterface+".Notify", 0,
+		"pullaway", uint32(0), iconPath, title, m.Message, actions, hints, expire)
+	if call.Err != nil {
+		return beeep.Notify(title, m.Message, iconPath)
+	}
+
+	if handler != nil {
+		var id uint32
+		if err := call.Store(&id); err != nil {
+			return err
+		}
+
+		watchNotificationActions(conn, n.log)
+
+		notificationActions.Lock()
+		notificationActions.handlers[id] = handler
+		notificationActions.Unlock()
+	}
+
+	return nil
+}
+
+// actions returns the action list for a message's notification, as
+// alternating keys and labels, and a handler for when one is invoked
+func (n *notifier) actions(m *pullaway.Messages) ([]string, func(action string)) {
+	actions := []string{}
+
+	if m.URL != "" {
+		// "default" is invoked by clicking the notification itself, or
+		// shown as a button by servers that render it as one
+		actions = append(actions, "default", "Open URL")
+	}
+
+	if m.Priority >= 2 && m.Receipt != "" && n.acknowledge != nil {
+		actions = append(actions, "acknowledge", "Acknowledge")
+	}
+
+	if len(actions) == 0 {
+		return actions, nil
+	}
+
+	msg := *m
+	return actions, func(action string) {
+		switch action {
+		case "default":
+			if err := openURL(msg.URL); err != nil {
+				n.log.Error("error opening message URL", "error", err.Error())
+			}
+		case "acknowledge":
+			if err := n.acknowledge(&msg); err != nil {
+				n.log.Error("error acknowledging message", "id", msg.ID, "error", err.Error())
+				return
+			}
+			n.log.Info("acknowledged message", "id", msg.ID)
+		}
+	}
+}
+
+// watchNotificationActions starts dispatching ActionInvoked signals to the
+// registered handlers, once per process
+func watchNotificationActions(conn *dbus.Conn, l pullaway.LeveledLogger) {
+	notificationActions.once.Do(func() {
+		err := conn.AddMatchSignal(
+			dbus.WithMatchInterface(notificationsInterface),
+			dbus.WithMatchObjectPath(notificationsPath),
+		)
+		if err != nil {
+			l.Error("error watching notification actions", "error", err.Error())
+			return
+		}
+
+		signals := make(chan *dbus.Signal, 16)
+		conn.Signal(signals)
+
+		go func() {
+			for sig := range signals {
+				if len(sig.Body) < 2 {
+					continue
+				}
+
+				id, _ := sig.Body[0].(uint32)
+
+				notificationActions.Lock()
+				handler := notificationActions.handlers[id]
+				if sig.Name == notificationsInterface+".NotificationClosed" {
+					delete(notificationActions.handlers, id)
+				}
+				notificationActions.Unlock()
+
+				if sig.Name != notificationsInterface+".ActionInvoked" || handler == nil {
+					continue
+				}
+
+				if action, ok := sig.Body[1].(string); ok {
+					go func() {
+						defer func() {
+							if r := recover(); r != nil {
+								l.Error("panic handling notification action", "action", action, "panic", pullaway.DefaultRedactor.Panic(r))
+							}
+						}()
+
+						handler(action)
+					}()
+				}
+			}
+		}()
+	})
+}
@@ -0,0 +1,18 @@
+//go:build !linux
+
+package main
+
+import (
+	"github.com/donatj/pullaway"
+	"github.com/gen2brain/beeep"
+)
+
+// send shows a notification via beeep, with an alert sound for urgent levels.
+// Notification actions are not supported on this platform.
+func (n *notifier) send(m *pullaway.Messages, l notifyLevel) error {
+	if l == notifyUrgent || l == notifyPersistent {
+		return beeep.Alert(notificationTitle(m), m.Message, iconPath)
+	}
+
+	return beeep.Notify(notificationTitle(m), m.Message, iconPath)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/donatj/pullaway"
+	"github.com/donatj/pullaway/assets"
+)
+
+var iconPath string
+
+func init() {
+	tdir, err := os.MkdirTemp("", "pullaway-assets")
+	if err != nil {
+		log.Fatalf("error creating temporary directory: %v", err)
+	}
+
+	iconPath = filepath.Join(tdir, "pullaway.png")
+
+	err = os.WriteFile(iconPath, assets.Icon, 0644)
+	if err != nil {
+		log.Fatalf("error writing icon file: %v", err)
+	}
+}
+
+// outputFlags holds the flags shared by subcommands that display messages
+type outputFlags struct {
+	format      string
+	templateStr string
+	outputs     outputList
+
+	notifications NotificationConfig
+
+	// acknowledge, when set, allows emergency messages to be acknowledged
+	// from their notification
+	acknowledge func(m *pullaway.Messages) error
+	l           pullaway.LeveledLogger
+}
+
+// outputList is a repeatable flag. Values given on the command line replace
+// those from the config file rather than adding to them.
+type outputList struct {
+	values []string
+	set    bool
+}
+
+func (o *outputList) String() string {
+	return strings.Join(o.values, ", ")
+}
+
+func (o *outputList) Set(v string) error {
+	if !o.set {
+		o.values, o.set = nil, true
+	}
+
+	o.values = append(o.values, v)
+	return nil
+}
+
+// SetFlags registers the output flags, defaulting to any values already set
+// from the config file
+func (o *outputFlags) SetFlags(f *flag.FlagSet) {
+	if o.format == "" {
+		o.format = "json"
+	}
+
+	f.StringVar(&o.format, "format", o.format, "Output format: json, text, template or notification")
+	f.StringVar(&o.templateStr, "template", o.templateStr, "Go template for formatting output (used with -format=template)")
+	f.Var(&o.outputs, "output", "Output as format or format:file to append to, may be repeated to write to several outputs (default: -format on stdout)")
+}
+
+// initOutputs returns a pipeline writing to every -output, or to -format on
+// stdout if there are none
+func (o *outputFlags) initOutputs() (*pullaway.Pipeline, error) {
+	p := pullaway.NewPipeline(o.l)
+
+	outputs := o.outputs.values
+	if len(outputs) == 0 {
+		outputs = []string{o.format}
+	}
+
+	for _, spec := range outputs {
+		s, err := o.newSink(spec)
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+
+		p.Add(spec, s)
+	}
+
+	return p, nil
+}
+
+// newSink creates the sink for an output given as format or format:file
+func (o *outputFlags) newSink(spec string) (pullaway.Sink, error) {
+	format, path, _ := strings.Cut(spec, ":")
+
+	var w io.Writer = os.Stdout
+	var f *os.File
+	if path != "" {
+		if format == "notification" {
+			return nil, fmt.Errorf("the notification output does not take a file")
+		}
+
+		var err error
+		f, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("error opening output file: %w", err)
+		}
+		w = f
+	}
+
+	s, err := o.newFormatSink(format, w)
+	if err != nil {
+		if f != nil {
+			f.Close()
+		}
+		return nil, err
+	}
+
+	if f != nil {
+		return fileSink{Sink: s, f: f}, nil
+	}
+
+	return s, nil
+}
+
+func (o *outputFlags) newFormatSink(format string, w io.Writer) (pullaway.Sink, error) {
+	switch format {
+	case "json":
+		return pullaway.NewJSONSink(w), nil
+	case "text":
+		return pullaway.NewTextSink(w), nil
+	case "notification":
+		n, err := newNotifier(o.notifications, o.acknowledge, o.l)
+		if err != nil {
+			return nil, err
+		}
+		return pullaway.SinkFunc(n.display), nil
+	case "template":
+		if o.templateStr == "" {
+			return nil, fmt.Errorf("template string must be provided when format is 'template'")
+		}
+		// Compile the template once
+		tmpl, err := template.New("output").Parse(o.templateStr)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing template: %w", err)
+		}
+		return pullaway.NewTemplateSink(w, tmpl), nil
+	default:
+		return nil, fmt.Errorf("unknown format: %s", format)
+	}
+}
+
+// fileSink is a sink writing to a file it closes with the pipeline
+type fileSink struct {
+	pullaway.Sink
+	f *os.File
+}
+
+func (s fileSink) Close() error {
+	return s.f.Close()
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/google/subcommands"
+)
+
+type profilesCmd struct {
+	config *Config
+}
+
+func (*profilesCmd) Name() string     { return "profiles" }
+func (*profilesCmd) Synopsis() string { return "list the configured profiles" }
+func (*profilesCmd) Usage() string {
+	return `profiles:
+	list the configured profiles, marking the active one with '*'
+`
+}
+
+func (st *profilesCmd) SetFlags(f *flag.FlagSet) {}
+
+func (st *profilesCmd) Execute(_ context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	profiles, err := st.config.Profiles()
+	if err != nil {
+		log.Printf("Error listing profiles: %v", err)
+		return subcommands.ExitFailure
+	}
+
+	for _, p := range profiles {
+		marker := " "
+		if p == st.config.Profile() {
+			marker = "*"
+		}
+
+		fmt.Printf("%s %s\n", marker, p)
+	}
+
+	return subcommands.ExitSuccess
+}
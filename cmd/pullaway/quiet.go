@@ -0,0 +1,127 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/donatj/pullaway"
+)
+
+// notifyLevelOrder ranks notification levels from least to most prominent
+var notifyLevelOrder = []notifyLevel{notifySuppress, notifyQuiet, notifyNormal, notifyUrgent, notifyPersistent}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// quietHours decides when notifications are limited and to which level
+type quietHours struct {
+	// start and end are offsets from midnight, equal when there is no local
+	// schedule
+	start, end time.Duration
+	days       []time.Weekday
+
+	level   notifyLevel
+	account bool
+}
+
+func newQuietHours(qc QuietHoursConfig) (*quietHours, error) {
+	q := &quietHours{
+		level:   notifyLevel(cmp.Or(qc.Level, string(notifySuppress))),
+		account: !qc.IgnoreAccount,
+	}
+
+	if !slices.Contains(notifyLevelOrder, q.level) {
+		return nil, fmt.Errorf("invalid quiet hours level %q", qc.Level)
+	}
+
+	if (qc.Start == "") != (qc.End == "") {
+		return nil, fmt.Errorf("quiet hours need both a start and an end")
+	}
+
+	if qc.Start != "" {
+		var err error
+		if q.start, err = parseTimeOfDay(qc.Start); err != nil {
+			return nil, err
+		}
+
+		if q.end, err = parseTimeOfDay(qc.End); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, d := range qc.Days {
+		wd, ok := weekdays[strings.ToLower(d)]
+		if !ok {
+			return nil, fmt.Errorf("invalid quiet hours day %q", d)
+		}
+
+		q.days = append(q.days, wd)
+	}
+
+	return q, nil
+}
+
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid quiet hours time %q, expected HH:MM", s)
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// scheduled returns whether t falls within the local schedule
+func (q *quietHours) scheduled(t time.Time) bool {
+	if q.start == q.end {
+		return false
+	}
+
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	day := t.Weekday()
+
+	if q.start < q.end {
+		if offset < q.start || offset >= q.end {
+			return false
+		}
+	} else {
+		switch {
+		case offset >= q.start:
+		case offset < q.end:
+			// the early morning belongs to the previous day's schedule
+			day = (day + 6) % 7
+		default:
+			return false
+		}
+	}
+
+	return len(q.days) == 0 || slices.Contains(q.days, day)
+}
+
+// limit returns the notification level for m at time t, lowering l to the
+// quiet hours level when quiet hours are in effect. Emergency messages are
+// never limited.
+func (q *quietHours) limit(m *pullaway.Messages, l notifyLevel, t time.Time) notifyLevel {
+	if m.Priority >= 2 {
+		return l
+	}
+
+	if !(q.account && m.QuietHours) && !q.scheduled(t) {
+		return l
+	}
+
+	if slices.Index(notifyLevelOrder, l) > slices.Index(notifyLevelOrder, q.level) {
+		return q.level
+	}
+
+	return l
+}
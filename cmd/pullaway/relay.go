@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+
+	"github.com/donatj/pullaway"
+	"golang.org/x/net/websocket"
+)
+
+// relay re-broadcasts received messages to local Server-Sent Events and
+// WebSocket subscribers, such as browser dashboards
+type relay struct {
+	b     *pullaway.Broadcaster
+	token string
+	l     pullaway.LeveledLogger
+
+	// origins are the browser origins allowed to subscribe. Requests without
+	// an Origin header are always allowed, "*" allows any origin.
+	origins []string
+}
+
+func (rl *relay) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /events", rl.handleEvents)
+	mux.Handle("GET /ws", websocket.Server{
+		Handshake: rl.handshake,
+		Handler:   rl.handleWebSocket,
+	})
+
+	return authorize(rl.token, mux)
+}
+
+func (rl *relay) allowOrigin(origin string) bool {
+	return origin == "" || slices.Contains(rl.origins, "*") || slices.Contains(rl.origins, origin)
+}
+
+func (rl *relay) handleEvents(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	if !rl.allowOrigin(origin) {
+		writeAPIError(w, http.StatusForbidden, fmt.Errorf("origin %s not allowed", origin))
+		return
+	}
+
+	if origin != "" {
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Add("Vary", "Origin")
+	}
+
+	serveEvents(w, r, rl.b)
+}
+
+func (rl *relay) handshake(config *websocket.Config, r *http.Request) error {
+	origin := r.Header.Get("Origin")
+	if !rl.allowOrigin(origin) {
+		return fmt.Errorf("origin %s not allowed", origin)
+	}
+
+	return nil
+}
+
+// handleWebSocket sends each message as a JSON text frame until the client
+// disconnects
+func (rl *relay) handleWebSocket(ws *websocket.Conn) {
+	defer ws.Close()
+
+	c, unsubscribe := rl.b.Subscribe(16)
+	defer unsubscribe()
+
+	err := pumpMessages(ws.Request().Context(), ws, c, func(m *pullaway.Messages) error {
+		return websocket.JSON.Send(ws, m)
+	})
+	if err != nil && !errors.Is(err, io.EOF) {
+		rl.l.Debug("error sending to WebSocket subscriber", "error", err.Error())
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/donatj/pullaway"
+)
+
+// listenAddr opens a TCP listener on addr, or a Unix socket when addr is
+// prefixed with "unix:". Unix sockets are only accessible by the current user.
+func listenAddr(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+
+	// remove a socket left behind by a previous run
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		_ = os.Remove(path)
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(path, 0600); err != nil {
+		ln.Close()
+		return nil, err
+	}
+
+	return ln, nil
+}
+
+// isLocalAddr reports whether addr is a Unix socket or a loopback TCP address
+func isLocalAddr(addr string) bool {
+	if strings.HasPrefix(addr, "unix:") {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// serveHTTP runs handler on addr until ctx is done
+func serveHTTP(ctx context.Context, addr string, handler http.Handler, l pullaway.LeveledLogger) error {
+	ln, err := listenAddr(addr)
+	if err != nil {
+		return fmt.Errorf("error listening on %s: %w", addr, err)
+	}
+
+	srv := &http.Server{
+		Handler: handler,
+		// cancel long-lived requests such as streams when shutting down
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = srv.Shutdown(context.Background())
+	}()
+
+	go func() {
+		l.Info("serving HTTP", "addr", addr)
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			l.Error("error serving HTTP", "addr", addr, "error", err.Error())
+		}
+	}()
+
+	return nil
+}
+
+// pumpMessages sends each message received on c with send until conn is
+// closed by the client, ctx is done or sending fails, returning the error
+// sending failed with. Anything the client sends on conn is discarded.
+func pumpMessages(ctx context.Context, conn io.Reader, c <-chan pullaway.Messages, send func(m *pullaway.Messages) error) error {
+	closed := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(io.Discard, conn)
+		close(closed)
+	}()
+
+	for {
+		select {
+		case m := <-c:
+			if err := send(&m); err != nil {
+				return err
+			}
+		case <-closed:
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
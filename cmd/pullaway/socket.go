@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+
+	"github.com/donatj/pullaway"
+)
+
+// serveSocket writes each message published to b as newline-delimited JSON to
+// every client connected on the Unix socket at path, until ctx is done.
+// Clients are first sent up to replay of the most recent messages.
+func serveSocket(ctx context.Context, path string, b *pullaway.Broadcaster, replay int, l pullaway.LeveledLogger) error {
+	ln, err := listenAddr("unix:" + path)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	go func() {
+		l.Info("serving messages on unix socket", "path", path)
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) {
+					l.Error("error accepting socket client", "error", err.Error())
+				}
+				return
+			}
+
+			go serveSocketClient(ctx, conn, b, replay, l)
+		}
+	}()
+
+	return nil
+}
+
+func serveSocketClient(ctx context.Context, conn net.Conn, b *pullaway.Broadcaster, replay int, l pullaway.LeveledLogger) {
+	defer conn.Close()
+
+	c, unsubscribe := b.SubscribeReplay(16, replay)
+	defer unsubscribe()
+
+	enc := json.NewEncoder(conn)
+	err := pumpMessages(ctx, conn, c, func(m *pullaway.Messages) error {
+		return enc.Encode(m)
+	})
+	if err != nil {
+		l.Debug("error writing to socket client", "error", err.Error())
+	}
+}
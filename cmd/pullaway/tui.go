@@ -0,0 +1,419 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/atotto/clipboard"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/donatj/pullaway"
+	"github.com/google/subcommands"
+)
+
+type tuiCmd struct {
+	config *Config
+	ac     *pullaway.AuthorizedClient
+}
+
+func (*tuiCmd) Name() string     { return "tui" }
+func (*tuiCmd) Synopsis() string { return "interactive inbox of incoming messages" }
+func (*tuiCmd) Usage() string {
+	return `tui:
+	full-screen inbox showing messages as they arrive
+
+	keys: up/down or j/k select, o open URL, c copy message, a acknowledge
+	emergency, f filter by app, esc clear filter, q quit
+`
+}
+
+func (st *tuiCmd) SetFlags(f *flag.FlagSet) {}
+
+func (st *tuiCmd) Execute(ctx context.Context, f *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	ac, err := loadAuthorizedClient(st.config)
+	if err != nil {
+		log.Println(err)
+		return subcommands.ExitFailure
+	}
+	st.ac = ac
+
+	if st.ac == nil {
+		log.Println("No authorized client found. Please run 'init' first.")
+		return subcommands.ExitFailure
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	p := tea.NewProgram(newInboxModel(st.ac), tea.WithAltScreen(), tea.WithContext(ctx))
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				p.Send(noticeMsg(fmt.Sprintf("stopped listening: panic: %s", pullaway.DefaultRedactor.Panic(r))))
+			}
+		}()
+
+		show := func(dr *pullaway.DownloadResponse) error {
+			if _, err := st.ac.DeleteMessages(dr.MaxID()); err != nil {
+				p.Send(noticeMsg(fmt.Sprintf("error deleting messages: %v", err)))
+			}
+
+			for _, m := range dr.Messages {
+				p.Send(messageMsg(m))
+			}
+
+			return nil
+		}
+
+		download := func() error {
+			dr, err := st.ac.DownloadMessages()
+			if err != nil {
+				p.Send(noticeMsg(fmt.Sprintf("error fetching messages: %v", err)))
+				return nil
+			}
+
+			return show(dr)
+		}
+
+		// logs would corrupt the screen, so connection state is shown instead
+		listener := st.ac.GetAuthorizedListener(nil)
+		listener.Polled = show
+		listener.Observers = append(listener.Observers, func(ev pullaway.ListenEvent, err error) {
+			p.Send(connectionMsg{ev: ev, err: err})
+		})
+
+		err := listener.ListenWithReconnectContext(ctx, download)
+		if err != nil && ctx.Err() == nil {
+			p.Send(noticeMsg(fmt.Sprintf("stopped listening: %v", err)))
+		}
+	}()
+
+	_, err = p.Run()
+	if err != nil && ctx.Err() == nil {
+		log.Printf("Error running inbox: %v", err)
+		return subcommands.ExitFailure
+	}
+
+	return subcommands.ExitSuccess
+}
+
+type (
+	messageMsg    pullaway.Messages
+	noticeMsg     string
+	connectionMsg struct {
+		ev  pullaway.ListenEvent
+		err error
+	}
+	ackResultMsg struct {
+		id  int64
+		err error
+	}
+)
+
+var (
+	tuiHeaderStyle   = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("12"))
+	tuiSelectedStyle = lipgloss.NewStyle().Reverse(true)
+	tuiDetailStyle   = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(0, 1)
+	tuiHelpStyle     = lipgloss.NewStyle().Faint(true)
+	tuiLabelStyle    = lipgloss.NewStyle().Bold(true)
+
+	tuiPriorityStyles = map[int]lipgloss.Style{
+		-2: lipgloss.NewStyle().Foreground(lipgloss.Color("8")),
+		-1: lipgloss.NewStyle().Faint(true),
+		0:  lipgloss.NewStyle(),
+		1:  lipgloss.NewStyle().Foreground(lipgloss.Color("11")),
+		2:  lipgloss.NewStyle().Foreground(lipgloss.Color("9")).Bold(true),
+	}
+)
+
+// inboxModel is the bubbletea model of the tui inbox
+type inboxModel struct {
+	ac *pullaway.AuthorizedClient
+
+	// messages holds every received message, newest first
+	messages []pullaway.Messages
+	filter   string
+	cursor   int
+	offset   int
+
+	status string
+	notice string
+
+	width, height int
+}
+
+func newInboxModel(ac *pullaway.AuthorizedClient) *inboxModel {
+	return &inboxModel{
+		ac:     ac,
+		status: "connecting",
+	}
+}
+
+func (m *inboxModel) Init() tea.Cmd {
+	return nil
+}
+
+// visible returns the messages matching the current filter
+func (m *inboxModel) visible() []pullaway.Messages {
+	if m.filter == "" {
+		return m.messages
+	}
+
+	var out []pullaway.Messages
+	for _, msg := range m.messages {
+		if msg.App == m.filter {
+			out = append(out, msg)
+		}
+	}
+
+	return out
+}
+
+func (m *inboxModel) selected() (pullaway.Messages, bool) {
+	vis := m.visible()
+	if m.cursor < 0 || m.cursor >= len(vis) {
+		return pullaway.Messages{}, false
+	}
+
+	return vis[m.cursor], true
+}
+
+func (m *inboxModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+	case messageMsg:
+		m.messages = append([]pullaway.Messages{pullaway.Messages(msg)}, m.messages...)
+		// keep the same message selected as new ones arrive above it
+		if m.cursor > 0 && (m.filter == "" || msg.App == m.filter) {
+			m.cursor++
+		}
+	case noticeMsg:
+		m.notice = string(msg)
+	case connectionMsg:
+		switch msg.ev {
+		case pullaway.EventLoggedIn:
+			m.status = "connected"
+		case pullaway.EventHeartbeat:
+			m.status = "connected, heartbeat " + time.Now().Format(time.TimeOnly)
+		case pullaway.EventDisconnected:
+			m.status = "disconnected, reconnecting"
+		}
+	case ackResultMsg:
+		if msg.err != nil {
+			m.notice = fmt.Sprintf("error acknowledging: %v", msg.err)
+			break
+		}
+
+		for i := range m.messages {
+			if m.messages[i].ID == msg.id {
+				m.messages[i].Acked = 1
+			}
+		}
+		m.notice = "acknowledged"
+	case tea.KeyMsg:
+		return m, m.handleKey(msg)
+	}
+
+	return m, nil
+}
+
+func (m *inboxModel) handleKey(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "q", "ctrl+c":
+		return tea.Quit
+	case "up", "k":
+		m.cursor = max(0, m.cursor-1)
+	case "down", "j":
+		m.cursor = min(len(m.visible())-1, m.cursor+1)
+	case "home", "g":
+		m.cursor = 0
+	case "end", "G":
+		m.cursor = len(m.visible()) - 1
+	case "f":
+		m.filter = m.nextApp()
+		m.cursor, m.offset = 0, 0
+	case "esc":
+		m.filter = ""
+		m.cursor, m.offset = 0, 0
+	case "o":
+		sel, ok := m.selected()
+		if !ok || sel.URL == "" {
+			m.notice = "message has no URL"
+			break
+		}
+
+		if err := openURL(sel.URL); err != nil {
+			m.notice = fmt.Sprintf("error opening URL: %v", err)
+		} else {
+			m.notice = "opened " + sel.URL
+		}
+	case "c":
+		sel, ok := m.selected()
+		if !ok {
+			break
+		}
+
+		if err := clipboard.WriteAll(sel.Message); err != nil {
+			m.notice = fmt.Sprintf("error copying: %v", err)
+		} else {
+			m.notice = "copied message to clipboard"
+		}
+	case "a":
+		sel, ok := m.selected()
+		if !ok || sel.Priority < 2 || sel.Receipt == "" {
+			m.notice = "only emergency messages can be acknowledged"
+			break
+		}
+
+		if sel.Acked != 0 {
+			m.notice = "already acknowledged"
+			break
+		}
+
+		m.notice = "acknowledging…"
+		return func() tea.Msg {
+			_, err := m.ac.AcknowledgeMessage(sel.Receipt)
+			return ackResultMsg{id: sel.ID, err: err}
+		}
+	}
+
+	m.cursor = max(0, m.cursor)
+
+	return nil
+}
+
+// nextApp returns the app after the current filter in sorted order, cycling
+// back to no filter after the last
+func (m *inboxModel) nextApp() string {
+	var apps []string
+	for _, msg := range m.messages {
+		if !slices.Contains(apps, msg.App) {
+			apps = append(apps, msg.App)
+		}
+	}
+	slices.Sort(apps)
+
+	if m.filter == "" {
+		if len(apps) == 0 {
+			return ""
+		}
+		return apps[0]
+	}
+
+	i := slices.Index(apps, m.filter)
+	if i < 0 || i+1 >= len(apps) {
+		return ""
+	}
+
+	return apps[i+1]
+}
+
+func (m *inboxModel) View() string {
+	if m.width == 0 {
+		return ""
+	}
+
+	header := "pullaway inbox · " + m.status
+	if m.filter != "" {
+		header += " · app: " + m.filter
+	}
+
+	detailHeight := max(8, m.height/3)
+	listHeight := max(1, m.height-detailHeight-4)
+
+	vis := m.visible()
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	}
+	if m.cursor >= m.offset+listHeight {
+		m.offset = m.cursor - listHeight + 1
+	}
+
+	line := lipgloss.NewStyle().MaxWidth(m.width)
+
+	var list []string
+	for i := m.offset; i < len(vis) && i < m.offset+listHeight; i++ {
+		msg := vis[i]
+		text := fmt.Sprintf("%s  %-12s  %s", messageTime(&msg).Format("Jan 02 15:04"), msg.App, oneLine(msg.Title, msg.Message))
+
+		style := tuiPriorityStyles[msg.Priority]
+		if i == m.cursor {
+			style = style.Inherit(tuiSelectedStyle)
+		}
+
+		list = append(list, line.Render(style.Render(text)))
+	}
+
+	for len(list) < listHeight {
+		list = append(list, "")
+	}
+
+	help := "↑/↓ select · o open URL · c copy · a acknowledge · f filter app · esc clear · q quit"
+	if m.notice != "" {
+		help = m.notice + " · " + help
+	}
+
+	return lipgloss.JoinVertical(lipgloss.Left,
+		line.Render(tuiHeaderStyle.Render(header)),
+		strings.Join(list, "\n"),
+		m.detailView(detailHeight),
+		line.Render(tuiHelpStyle.Render(help)),
+	)
+}
+
+// detailView renders the selected message in full
+func (m *inboxModel) detailView(height int) string {
+	style := tuiDetailStyle.Width(m.width - 2).Height(height - 2).MaxHeight(height)
+
+	sel, ok := m.selected()
+	if !ok {
+		return style.Render("No messages yet")
+	}
+
+	fields := []string{
+		tuiLabelStyle.Render("From: ") + sel.App + "   " +
+			tuiLabelStyle.Render("Priority: ") + tuiPriorityStyles[sel.Priority].Render(fmt.Sprint(sel.Priority)) + "   " +
+			tuiLabelStyle.Render("Date: ") + messageTime(&sel).Format(time.DateTime),
+	}
+
+	if sel.Title != "" {
+		fields = append(fields, tuiLabelStyle.Render("Title: ")+sel.Title)
+	}
+
+	if sel.URL != "" {
+		fields = append(fields, tuiLabelStyle.Render("URL: ")+sel.URL)
+	}
+
+	if sel.Priority >= 2 {
+		acked := "no (press a)"
+		if sel.Acked != 0 {
+			acked = "yes"
+		}
+		fields = append(fields, tuiLabelStyle.Render("Acknowledged: ")+acked)
+	}
+
+	fields = append(fields, "", sel.Message)
+
+	return style.Render(strings.Join(fields, "\n"))
+}
+
+func messageTime(m *pullaway.Messages) time.Time {
+	return time.Unix(int64(m.Date), 0)
+}
+
+// oneLine joins the title and message for display on a single line
+func oneLine(title, message string) string {
+	s := message
+	if title != "" {
+		s = title + " - " + message
+	}
+
+	return strings.Join(strings.Fields(s), " ")
+}
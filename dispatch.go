@@ -0,0 +1,350 @@
+package pullaway
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// ErrDispatcherClosed is returned when handing a message to a closed
+// Dispatcher
+var ErrDispatcherClosed = errors.New("dispatcher closed")
+
+// OverflowPolicy decides what a Dispatcher does with a message when the
+// queue it belongs in is full
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits for room in the queue
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest discards the oldest queued message
+	OverflowDropOldest
+	// OverflowSpill writes messages to a file until the queue catches up
+	OverflowSpill
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowDropOldest:
+		return "drop-oldest"
+	case OverflowSpill:
+		return "spill"
+	default:
+		return fmt.Sprintf("OverflowPolicy(%d)", int(p))
+	}
+}
+
+// ParseOverflowPolicy parses "block", "drop-oldest" or "spill"
+func ParseOverflowPolicy(s string) (OverflowPolicy, error) {
+	for _, p := range []OverflowPolicy{OverflowBlock, OverflowDropOldest, OverflowSpill} {
+		if s == p.String() {
+			return p, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown overflow policy %q, expected block, drop-oldest or spill", s)
+}
+
+// DispatcherConfig configures a Dispatcher. Zero values use the defaults.
+type DispatcherConfig struct {
+	// Workers is how many messages are handled concurrently, 1 by default
+	Workers int
+	// QueueSize is how many messages each worker may have waiting, 100 by
+	// default
+	QueueSize int
+	// Policy applies when a worker's queue is full
+	Policy OverflowPolicy
+	// SpillDir is where OverflowSpill writes messages, the temporary
+	// directory by default
+	SpillDir string
+}
+
+// Dispatcher hands messages to a MessageHandler on a bounded pool of workers,
+// so a slow handler does not hold up listening. Messages of the same app and
+// account are always handled by the same worker, in the order received.
+type Dispatcher struct {
+	Log LeveledLogger
+
+	h      MessageHandler
+	queues []*dispatchQueue
+	wg     sync.WaitGroup
+}
+
+func NewDispatcher(h MessageHandler, cfg DispatcherConfig, l LeveledLogger) *Dispatcher {
+	if l == nil {
+		l = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+
+	cfg.Workers = max(cfg.Workers, 1)
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 100
+	}
+
+	d := &Dispatcher{
+		Log: l,
+		h:   h,
+	}
+
+	for range cfg.Workers {
+		q := &dispatchQueue{
+			size:     cfg.QueueSize,
+			policy:   cfg.Policy,
+			spillDir: cfg.SpillDir,
+			log:      l,
+		}
+		q.cond = sync.NewCond(&q.mu)
+		d.queues = append(d.queues, q)
+
+		d.wg.Add(1)
+		go d.work(q)
+	}
+
+	return d
+}
+
+// Handle queues m for its worker according to the overflow policy. Handle
+// satisfies MessageHandler; errors from the wrapped handler are logged.
+func (d *Dispatcher) Handle(m *Messages) error {
+	h := fnv.New32a()
+	h.Write([]byte(m.Account + "\x00" + m.App))
+
+	return d.queues[h.Sum32()%uint32(len(d.queues))].push(*m)
+}
+
+func (d *Dispatcher) work(q *dispatchQueue) {
+	defer d.wg.Done()
+
+	for {
+		m, ok := q.pop()
+		if !ok {
+			return
+		}
+
+		if err := d.handle(&m); err != nil {
+			d.Log.Error("error handling message", "id", m.ID, "error", err.Error())
+		}
+	}
+}
+
+// handle calls the handler, recovering a panic so it does not take down the
+// process from the worker goroutine
+func (d *Dispatcher) handle(m *Messages) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %s", DefaultRedactor.Panic(r))
+		}
+	}()
+
+	return d.h(m)
+}
+
+// Close stops accepting messages and waits for those queued to be handled
+func (d *Dispatcher) Close() error {
+	for _, q := range d.queues {
+		q.close()
+	}
+
+	d.wg.Wait()
+
+	var errs []error
+	for _, q := range d.queues {
+		errs = append(errs, q.removeSpill())
+	}
+
+	return errors.Join(errs...)
+}
+
+// dispatchQueue is the bounded queue of a single worker. Once it has spilled
+// to disk, later messages are spilled too until the file is drained, so
+// order is kept.
+type dispatchQueue struct {
+	size     int
+	policy   OverflowPolicy
+	spillDir string
+	log      LeveledLogger
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	items  []Messages
+	closed bool
+
+	spilled int
+	spillW  *os.File
+	spillR  *os.File
+	spillBR *bufio.Reader
+}
+
+func (q *dispatchQueue) push(m Messages) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.closed {
+		return ErrDispatcherClosed
+	}
+
+	switch q.policy {
+	case OverflowBlock:
+		for len(q.items) >= q.size && !q.closed {
+			q.cond.Wait()
+		}
+	case OverflowDropOldest:
+		if len(q.items) >= q.size {
+			q.log.Warn("queue full, dropping oldest message", "id", q.items[0].ID)
+			q.items = q.items[1:]
+		}
+	case OverflowSpill:
+		if q.spilled > 0 || len(q.items) >= q.size {
+			err := q.spill(m)
+			if err == nil {
+				q.cond.Broadcast()
+				return nil
+			}
+
+			if q.spilled > 0 {
+				// queued in memory, m would overtake the spilled messages
+				q.log.Error("error spilling message, waiting for spilled messages to be handled", "id", m.ID, "error", err.Error())
+				for q.spilled > 0 {
+					q.cond.Wait()
+				}
+			} else {
+				q.log.Error("error spilling message, keeping it in memory", "id", m.ID, "error", err.Error())
+			}
+		}
+	}
+
+	q.items = append(q.items, m)
+	q.cond.Broadcast()
+
+	return nil
+}
+
+// pop waits for the next message, returning false once closed and drained
+func (q *dispatchQueue) pop() (Messages, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for {
+		for len(q.items) == 0 && q.spilled == 0 && !q.closed {
+			q.cond.Wait()
+		}
+
+		if len(q.items) > 0 {
+			m := q.items[0]
+			q.items = q.items[1:]
+			q.cond.Broadcast()
+
+			return m, true
+		}
+
+		if q.spilled == 0 {
+			return Messages{}, false
+		}
+
+		m, err := q.unspill()
+		if err != nil {
+			q.log.Error("error reading spilled messages, discarding them", "count", q.spilled, "error", err.Error())
+			q.resetSpill()
+			continue
+		}
+
+		return m, true
+	}
+}
+
+func (q *dispatchQueue) spill(m Messages) error {
+	if q.spillW == nil {
+		w, err := os.CreateTemp(q.spillDir, "pullaway-spill-*")
+		if err != nil {
+			return err
+		}
+
+		r, err := os.Open(w.Name())
+		if err != nil {
+			w.Close()
+			os.Remove(w.Name())
+			return err
+		}
+
+		q.spillW, q.spillR, q.spillBR = w, r, bufio.NewReader(r)
+	}
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	if _, err := q.spillW.Write(append(b, '\n')); err != nil {
+		return err
+	}
+
+	if q.spilled == 0 {
+		q.log.Warn("queue full, spilling messages to disk", "path", q.spillW.Name())
+	}
+	q.spilled++
+
+	return nil
+}
+
+func (q *dispatchQueue) unspill() (Messages, error) {
+	line, err := q.spillBR.ReadBytes('\n')
+	if err != nil {
+		return Messages{}, err
+	}
+
+	var m Messages
+	if err := json.Unmarshal(line, &m); err != nil {
+		return Messages{}, err
+	}
+
+	q.spilled--
+	if q.spilled == 0 {
+		q.resetSpill()
+	}
+
+	return m, nil
+}
+
+// resetSpill empties the spill file for reuse, waking pushes waiting for
+// the spilled messages to be handled
+func (q *dispatchQueue) resetSpill() {
+	q.spilled = 0
+	q.cond.Broadcast()
+
+	if err := q.spillW.Truncate(0); err != nil {
+		q.log.Error("error truncating spill file", "error", err.Error())
+	}
+	if _, err := q.spillW.Seek(0, io.SeekStart); err != nil {
+		q.log.Error("error rewinding spill file", "error", err.Error())
+	}
+	if _, err := q.spillR.Seek(0, io.SeekStart); err != nil {
+		q.log.Error("error rewinding spill file", "error", err.Error())
+	}
+	q.spillBR.Reset(q.spillR)
+}
+
+func (q *dispatchQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+func (q *dispatchQueue) removeSpill() error {
+	if q.spillW == nil {
+		return nil
+	}
+
+	q.spillR.Close()
+	q.spillW.Close()
+
+	return os.Remove(q.spillW.Name())
+}
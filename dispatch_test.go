@@ -0,0 +1,237 @@
+package pullaway
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gatedHandler records the IDs of handled messages, holding each until the
+// gate is opened
+type gatedHandler struct {
+	gate    chan struct{}
+	started chan struct{}
+
+	mu  sync.Mutex
+	ids []int64
+}
+
+func newGatedHandler() *gatedHandler {
+	return &gatedHandler{
+		gate:    make(chan struct{}),
+		started: make(chan struct{}, 100),
+	}
+}
+
+func (g *gatedHandler) handle(m *Messages) error {
+	g.started <- struct{}{}
+	<-g.gate
+
+	g.mu.Lock()
+	g.ids = append(g.ids, m.ID)
+	g.mu.Unlock()
+
+	return nil
+}
+
+func (g *gatedHandler) handled() []int64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return slices.Clone(g.ids)
+}
+
+// pushAll hands each ID to d in order, returning a channel closed once all
+// have been accepted
+func pushAll(t *testing.T, d *Dispatcher, ids ...int64) chan struct{} {
+	t.Helper()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, id := range ids {
+			if err := d.Handle(&Messages{ID: id, App: "app"}); err != nil {
+				t.Errorf("Handle(%d): %v", id, err)
+			}
+		}
+	}()
+
+	return done
+}
+
+func TestDispatcherOverflow(t *testing.T) {
+	tests := []struct {
+		policy OverflowPolicy
+		blocks bool
+		want   []int64
+	}{
+		{OverflowBlock, true, []int64{1, 2, 3, 4, 5, 6}},
+		{OverflowDropOldest, false, []int64{1, 5, 6}},
+		{OverflowSpill, false, []int64{1, 2, 3, 4, 5, 6}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			spillDir := t.TempDir()
+			g := newGatedHandler()
+			d := NewDispatcher(g.handle, DispatcherConfig{
+				Workers:   1,
+				QueueSize: 2,
+				Policy:    tt.policy,
+				SpillDir:  spillDir,
+			}, nil)
+
+			// the worker holds message 1, the queue then fills with 2 and 3
+			<-pushAll(t, d, 1)
+			<-g.started
+			done := pushAll(t, d, 2, 3, 4, 5, 6)
+
+			select {
+			case <-done:
+				if tt.blocks {
+					t.Fatal("Handle did not block with a full queue")
+				}
+			case <-time.After(100 * time.Millisecond):
+				if !tt.blocks {
+					t.Fatal("Handle blocked with a full queue")
+				}
+			}
+
+			close(g.gate)
+			<-done
+
+			if err := d.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := g.handled(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("handled %v, want %v", got, tt.want)
+			}
+
+			if entries, _ := os.ReadDir(spillDir); len(entries) > 0 {
+				t.Errorf("spill files left behind: %v", entries)
+			}
+		})
+	}
+}
+
+func TestDispatcherSpillErrorWithPendingSpill(t *testing.T) {
+	g := newGatedHandler()
+	d := NewDispatcher(g.handle, DispatcherConfig{
+		Workers:   1,
+		QueueSize: 1,
+		Policy:    OverflowSpill,
+		SpillDir:  t.TempDir(),
+	}, nil)
+
+	// 1 is held by the worker, 2 is queued and 3 spilled
+	<-pushAll(t, d, 1)
+	<-g.started
+	<-pushAll(t, d, 2, 3)
+
+	// make spilling fail, so 4 must wait for 3 rather than overtake it
+	q := d.queues[0]
+	q.mu.Lock()
+	q.spillW.Close()
+	q.mu.Unlock()
+
+	done := pushAll(t, d, 4)
+	select {
+	case <-done:
+		t.Fatal("Handle did not wait for the spilled messages")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(g.gate)
+	<-done
+
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := g.handled(), []int64{1, 2, 3, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("handled %v, want %v", got, want)
+	}
+}
+
+func TestDispatcherSpillErrorKeepsInMemory(t *testing.T) {
+	g := newGatedHandler()
+	d := NewDispatcher(g.handle, DispatcherConfig{
+		Workers:   1,
+		QueueSize: 1,
+		Policy:    OverflowSpill,
+		SpillDir:  filepath.Join(t.TempDir(), "missing"),
+	}, nil)
+
+	<-pushAll(t, d, 1)
+	<-g.started
+
+	// nothing has been spilled, so failing to spill keeps 3 in memory
+	select {
+	case <-pushAll(t, d, 2, 3):
+	case <-time.After(time.Second):
+		t.Fatal("Handle blocked after failing to spill")
+	}
+
+	close(g.gate)
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := g.handled(), []int64{1, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("handled %v, want %v", got, want)
+	}
+}
+
+func TestDispatcherClose(t *testing.T) {
+	g := newGatedHandler()
+	close(g.gate)
+
+	d := NewDispatcher(g.handle, DispatcherConfig{Workers: 2, QueueSize: 10}, nil)
+
+	want := []int64{1, 2, 3, 4, 5}
+	<-pushAll(t, d, want...)
+
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := g.handled(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Close returned before draining: handled %v, want %v", got, want)
+	}
+
+	if err := d.Handle(&Messages{ID: 6}); !errors.Is(err, ErrDispatcherClosed) {
+		t.Errorf("Handle after Close returned %v, want ErrDispatcherClosed", err)
+	}
+}
+
+func TestDispatcherRecoversPanic(t *testing.T) {
+	var mu sync.Mutex
+	var handled []int64
+
+	d := NewDispatcher(func(m *Messages) error {
+		if m.ID == 1 {
+			panic("handler panic")
+		}
+
+		mu.Lock()
+		handled = append(handled, m.ID)
+		mu.Unlock()
+
+		return nil
+	}, DispatcherConfig{}, nil)
+
+	<-pushAll(t, d, 1, 2)
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []int64{2}; !reflect.DeepEqual(handled, want) {
+		t.Errorf("handled %v, want %v", handled, want)
+	}
+}
@@ -0,0 +1,123 @@
+package pullaway
+
+import "fmt"
+
+// FrameType identifies a frame of the Open Client push protocol
+type FrameType byte
+
+const (
+	// FrameUnknown is a frame not defined by the protocol
+	FrameUnknown FrameType = 0
+	// FrameHeartbeat is sent periodically to keep the connection alive
+	FrameHeartbeat FrameType = '#'
+	// FrameMessage signals that new messages are waiting to be downloaded
+	FrameMessage FrameType = '!'
+	// FrameReconnect asks the client to reconnect
+	FrameReconnect FrameType = 'R'
+	// FrameError is a permanent error, the client should not reconnect
+	FrameError FrameType = 'E'
+	// FrameSessionClosed means the session was closed, e.g. by another login
+	FrameSessionClosed FrameType = 'A'
+)
+
+func (t FrameType) String() string {
+	switch t {
+	case FrameHeartbeat:
+		return "heartbeat"
+	case FrameMessage:
+		return "message"
+	case FrameReconnect:
+		return "reconnect"
+	case FrameError:
+		return "error"
+	case FrameSessionClosed:
+		return "session-closed"
+	case FrameUnknown:
+		return "unknown"
+	default:
+		return fmt.Sprintf("FrameType(%d)", byte(t))
+	}
+}
+
+// Frame is a single frame of the push stream
+type Frame struct {
+	Type FrameType
+	// Data holds the raw bytes of a FrameUnknown
+	Data []byte
+}
+
+// maxUnknownFrame bounds how much of an unknown frame is buffered
+const maxUnknownFrame = 256
+
+// FrameParser splits the push stream into frames. The stream is split into
+// tokens at whitespace and the end of each WebSocket message, so a token may
+// span several reads. A token made up only of known frame bytes is a run of
+// known frames sent back to back, such as "#!". Any other token, such as a
+// multi-character frame added to the protocol later, is a single unknown
+// frame.
+//
+// The zero value is ready to use.
+type FrameParser struct {
+	token []byte
+}
+
+// Feed parses the next chunk read from the stream, returning the frames it
+// completed. A token at the end of data is held until it is ended by a later
+// Feed or by End.
+func (p *FrameParser) Feed(data []byte) []Frame {
+	var frames []Frame
+	for _, b := range data {
+		if isFrameSeparator(b) {
+			frames = p.flush(frames)
+			continue
+		}
+
+		p.token = append(p.token, b)
+		if len(p.token) >= maxUnknownFrame {
+			frames = p.flush(frames)
+		}
+	}
+
+	return frames
+}
+
+// End marks the end of a WebSocket message, returning the frames of any token
+// held back by Feed
+func (p *FrameParser) End() []Frame {
+	return p.flush(nil)
+}
+
+// flush appends the frames of the buffered token to frames
+func (p *FrameParser) flush(frames []Frame) []Frame {
+	if len(p.token) == 0 {
+		return frames
+	}
+
+	token := p.token
+	p.token = nil
+
+	for _, b := range token {
+		if !isKnownFrame(b) {
+			return append(frames, Frame{Type: FrameUnknown, Data: token})
+		}
+	}
+
+	for _, b := range token {
+		frames = append(frames, Frame{Type: FrameType(b)})
+	}
+
+	return frames
+}
+
+func isKnownFrame(b byte) bool {
+	switch FrameType(b) {
+	case FrameHeartbeat, FrameMessage, FrameReconnect, FrameError, FrameSessionClosed:
+		return true
+	default:
+		return false
+	}
+}
+
+func isFrameSeparator(b byte) bool {
+	return b == '\n' || b == '\r' || b == ' ' || b == '\t'
+}
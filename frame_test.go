@@ -0,0 +1,115 @@
+package pullaway
+
+import (
+	"bytes"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFrameParser(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		want   []Frame
+	}{
+		{"heartbeat", []string{"#"}, []Frame{{Type: FrameHeartbeat}}},
+		{"message", []string{"!"}, []Frame{{Type: FrameMessage}}},
+		{"reconnect", []string{"R"}, []Frame{{Type: FrameReconnect}}},
+		{"error", []string{"E"}, []Frame{{Type: FrameError}}},
+		{"session closed", []string{"A"}, []Frame{{Type: FrameSessionClosed}}},
+		{"back to back", []string{"#!"}, []Frame{{Type: FrameHeartbeat}, {Type: FrameMessage}}},
+		{"trailing newline", []string{"#\n"}, []Frame{{Type: FrameHeartbeat}}},
+		{"separators", []string{" #\r\n\t! "}, []Frame{{Type: FrameHeartbeat}, {Type: FrameMessage}}},
+		{"unknown", []string{"hello"}, []Frame{{Type: FrameUnknown, Data: []byte("hello")}}},
+		{"unknown followed by known byte", []string{"hello#"}, []Frame{{Type: FrameUnknown, Data: []byte("hello#")}}},
+		{"known byte followed by unknown", []string{"#hello"}, []Frame{{Type: FrameUnknown, Data: []byte("#hello")}}},
+		{"word starting with a frame byte", []string{"Alert"}, []Frame{{Type: FrameUnknown, Data: []byte("Alert")}}},
+		{"frame byte with unknown tail", []string{"Rx"}, []Frame{{Type: FrameUnknown, Data: []byte("Rx")}}},
+		{"word across chunks", []string{"Al", "ert\n#"}, []Frame{{Type: FrameUnknown, Data: []byte("Alert")}, {Type: FrameHeartbeat}}},
+		{"unknown then known", []string{"hello #"}, []Frame{{Type: FrameUnknown, Data: []byte("hello")}, {Type: FrameHeartbeat}}},
+		{"unknown across chunks", []string{"hel", "lo", "\n!"}, []Frame{{Type: FrameUnknown, Data: []byte("hello")}, {Type: FrameMessage}}},
+		{"oversized unknown", []string{strings.Repeat("x", maxUnknownFrame+1)}, []Frame{
+			{Type: FrameUnknown, Data: bytes.Repeat([]byte("x"), maxUnknownFrame)},
+			{Type: FrameUnknown, Data: []byte("x")},
+		}},
+		{"empty", []string{""}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &FrameParser{}
+
+			var got []Frame
+			for _, c := range tt.chunks {
+				got = append(got, p.Feed([]byte(c))...)
+			}
+			got = append(got, p.End()...)
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFrameParserEndHoldsToken(t *testing.T) {
+	p := &FrameParser{}
+
+	if got := p.Feed([]byte("# abc")); !reflect.DeepEqual(got, []Frame{{Type: FrameHeartbeat}}) {
+		t.Fatalf("Feed returned %v, want only the heartbeat", got)
+	}
+
+	want := []Frame{{Type: FrameUnknown, Data: []byte("abc")}}
+	if got := p.End(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("End returned %v, want %v", got, want)
+	}
+
+	if got := p.End(); got != nil {
+		t.Fatalf("second End returned %v, want nil", got)
+	}
+}
+
+// FuzzFrameParser feeds data in chunks of chunk bytes, checking that the
+// frames are well formed and the same as feeding data at once
+func FuzzFrameParser(f *testing.F) {
+	f.Fuzz(func(t *testing.T, data []byte, chunk uint8) {
+		p := &FrameParser{}
+
+		var got []Frame
+		for rest := data; len(rest) > 0; {
+			n := min(max(int(chunk), 1), len(rest))
+			got = append(got, p.Feed(rest[:n])...)
+			rest = rest[n:]
+		}
+		got = append(got, p.End()...)
+
+		for _, fr := range got {
+			switch fr.Type {
+			case FrameHeartbeat, FrameMessage, FrameReconnect, FrameError, FrameSessionClosed:
+				if fr.Data != nil {
+					t.Fatalf("%s frame has data %q", fr.Type, fr.Data)
+				}
+			case FrameUnknown:
+				if len(fr.Data) == 0 || len(fr.Data) > maxUnknownFrame {
+					t.Fatalf("unknown frame of %d bytes", len(fr.Data))
+				}
+				if bytes.ContainsAny(fr.Data, "\n\r \t") {
+					t.Fatalf("unknown frame %q contains a separator", fr.Data)
+				}
+				if !slices.ContainsFunc(fr.Data, func(b byte) bool { return !isKnownFrame(b) }) {
+					t.Fatalf("unknown frame %q is made up of known frames", fr.Data)
+				}
+			default:
+				t.Fatalf("unexpected frame type %s", fr.Type)
+			}
+		}
+
+		whole := &FrameParser{}
+		want := append(whole.Feed(data), whole.End()...)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("chunked frames %v differ from %v", got, want)
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package pullaway
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -29,8 +30,69 @@ type LeveledLogger interface {
 	Warn(string, ...interface{})
 }
 
+// NewLeveledLogger adapts any slog.Handler to a LeveledLogger. A nil handler
+// discards everything.
+func NewLeveledLogger(h slog.Handler) LeveledLogger {
+	if h == nil {
+		h = slog.NewTextHandler(io.Discard, nil)
+	}
+
+	return slog.New(h)
+}
+
+// ListenEvent describes a change in the state of a Listener's connection
+type ListenEvent int
+
+const (
+	// EventLoggedIn is sent when the first frame is received after logging in
+	EventLoggedIn ListenEvent = iota + 1
+	// EventHeartbeat is sent for each heartbeat frame
+	EventHeartbeat
+	// EventMessage is sent for each new message notification, before the
+	// MessageCallback is called
+	EventMessage
+	// EventDisconnected is sent when Listen returns, with the error it returns
+	EventDisconnected
+)
+
+func (e ListenEvent) String() string {
+	switch e {
+	case EventLoggedIn:
+		return "logged-in"
+	case EventHeartbeat:
+		return "heartbeat"
+	case EventMessage:
+		return "message"
+	case EventDisconnected:
+		return "disconnected"
+	default:
+		return fmt.Sprintf("ListenEvent(%d)", int(e))
+	}
+}
+
+// ListenObserver is called synchronously from the listening goroutine for
+// each ListenEvent. err is only set for EventDisconnected.
+type ListenObserver func(ev ListenEvent, err error)
+
 type Listener struct {
 	Log LeveledLogger
+
+	// Observers are notified of connection state changes. They must be set
+	// before listening begins.
+	Observers []ListenObserver
+
+	// Mode selects how ListenWithReconnect learns of new messages, over the
+	// WebSocket by default
+	Mode ListenMode
+	// Poll configures polling in ListenModePoll and ListenModeAuto
+	Poll PollConfig
+	// Client is used to poll for messages and provides the Network the
+	// WebSocket connects with. The default API and network if nil.
+	Client *PushoverClient
+	// Polled, if set, is given the messages found while polling instead of
+	// calling the MessageCallback, which would download them again. It is
+	// responsible for deleting them from the server.
+	Polled DownloadCallback
 }
 
 func NewListener(l LeveledLogger) *Listener {
@@ -43,38 +105,119 @@ func NewListener(l LeveledLogger) *Listener {
 	}
 }
 
+func (l *Listener) notify(ev ListenEvent, err error) {
+	for _, o := range l.Observers {
+		o(ev, err)
+	}
+}
+
 func (l *Listener) ListenWithReconnect(deviceID string, secret string, ml MessageCallback) error {
+	return l.ListenWithReconnectContext(context.Background(), deviceID, secret, ml)
+}
+
+// ListenWithReconnectContext is like ListenWithReconnect but stops once ctx is
+// done, returning ctx.Err() after any in-flight MessageCallback completes.
+func (l *Listener) ListenWithReconnectContext(ctx context.Context, deviceID string, secret string, ml MessageCallback) error {
 connect:
 	for {
-		err := l.Listen(deviceID, secret, ml)
+		var err error
+		if l.Mode == ListenModePoll {
+			err = l.PollContext(ctx, deviceID, secret, ml)
+		} else {
+			err = l.ListenContext(ctx, deviceID, secret, ml)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if l.Mode == ListenModeAuto && errors.Is(err, ErrWebsocketConnectFail) {
+			l.Log.Warn("WebSocket unavailable, polling instead", "error", err.Error())
+			err = l.poll(ctx, deviceID, secret, ml, l.Poll.withDefaults().WebSocketRetry)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			if errors.Is(err, ErrRetryWebSocket) {
+				continue connect
+			}
+		}
+
 		if errors.Is(err, ErrPermanentIssue) || errors.Is(err, ErrSessionIssue) {
 			return fmt.Errorf("listen error: %w", err)
 		}
 
 		if errors.Is(err, ErrNeedReconnect) {
 			l.Log.Info("reconnecting on request", "error", err.Error())
-			time.Sleep(5 * time.Second)
+			if err := sleepContext(ctx, 5*time.Second); err != nil {
+				return err
+			}
 			continue connect
 		}
 
-		l.Log.Error("error listening to WebSocket", "error", err.Error())
-		time.Sleep(15 * time.Second)
+		l.Log.Error("error listening", "mode", l.Mode.String(), "error", err.Error())
+		if err := sleepContext(ctx, 15*time.Second); err != nil {
+			return err
+		}
 	}
 }
 
+// sleepContext pauses for d, returning early with ctx.Err() if ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// MessageCallback is called when new messages are waiting to be downloaded.
+// It is also called once after each login is sent, so messages sent while
+// disconnected are not missed.
 type MessageCallback func() error
 
+// DownloadCallback is given messages that were already downloaded
+type DownloadCallback func(dr *DownloadResponse) error
+
 func (l *Listener) Listen(deviceID string, secret string, ml MessageCallback) error {
+	return l.ListenContext(context.Background(), deviceID, secret, ml)
+}
+
+// ListenContext is like Listen but closes the connection once ctx is done.
+// A MessageCallback in progress is allowed to complete before it returns.
+func (l *Listener) ListenContext(ctx context.Context, deviceID string, secret string, ml MessageCallback) (err error) {
+	DefaultRedactor.Add(deviceID, secret)
+
+	defer func() {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		l.notify(EventDisconnected, err)
+	}()
+
 	origin := "http://localhost/"
 	url := "wss://client.pushover.net/push"
 
 	// Establish WebSocket connection
-	ws, err := websocket.Dial(url, "", origin)
+	config, err := websocket.NewConfig(url, origin)
+	if err != nil {
+		return errors.Join(ErrWebsocketConnectFail, err)
+	}
+
+	ws, err := l.Client.network().dialWebSocket(ctx, config)
 	if err != nil {
 		return errors.Join(ErrWebsocketConnectFail, err)
 	}
 	defer ws.Close()
 
+	stop := context.AfterFunc(ctx, func() {
+		ws.Close()
+	})
+	defer stop()
+
 	l.Log.Info("listening to WebSocket", "url", url)
 
 	loginMessage := fmt.Sprintf("login:%s:%s\n", deviceID, secret)
@@ -83,32 +226,45 @@ func (l *Listener) Listen(deviceID string, secret string, ml MessageCallback) er
 		return errors.Join(ErrWebsocketLoginFail, err)
 	}
 
+	// messages may have arrived while disconnected, so reconcile with the
+	// server rather than waiting for the first frame
+	if err := ml(); err != nil {
+		return err
+	}
+
+	var parser FrameParser
+	loggedIn := false
 	for {
-		var msg = make([]byte, 512)
-		// Read message from WebSocket
-		n, err := ws.Read(msg)
-		if err != nil {
+		// Read a whole message from the WebSocket
+		var msg []byte
+		if err := websocket.Message.Receive(ws, &msg); err != nil {
 			return errors.Join(ErrWebsocketReadFail, err)
 		}
 
-		l.Log.Debug("received message", "message", string(msg[:n]))
+		l.Log.Debug("received message", "message", string(msg))
 
-		for _, m := range msg[:n] {
-			switch m {
-			case '#': // Heartbeat
-				// PONG
-			case '!': // Message
+		for _, f := range append(parser.Feed(msg), parser.End()...) {
+			if !loggedIn && (f.Type == FrameHeartbeat || f.Type == FrameMessage) {
+				loggedIn = true
+				l.notify(EventLoggedIn, nil)
+			}
+
+			switch f.Type {
+			case FrameHeartbeat:
+				l.notify(EventHeartbeat, nil)
+			case FrameMessage:
+				l.notify(EventMessage, nil)
 				if err := ml(); err != nil {
 					return err
 				}
-			case 'R': // Reconnect
+			case FrameReconnect:
 				return ErrNeedReconnect
-			case 'E': // Error, Permanent
+			case FrameError:
 				return ErrPermanentIssue
-			case 'A': // Error, Session Closed
+			case FrameSessionClosed:
 				return ErrSessionIssue
 			default:
-				l.Log.Warn("unknown message", "message", string(m))
+				l.Log.Warn("unknown frame", "frame", string(f.Data))
 			}
 		}
 	}
@@ -132,9 +288,12 @@ type AuthorizedListener struct {
 }
 
 func NewAuthorizedListener(ac *AuthorizedClient, l LeveledLogger) *AuthorizedListener {
+	listener := NewListener(l)
+	listener.Client = ac.PushoverClient
+
 	return &AuthorizedListener{
 		AuthorizedClient: ac,
-		Listener:         NewListener(l),
+		Listener:         listener,
 	}
 }
 
@@ -145,3 +304,11 @@ func (al *AuthorizedListener) ListenWithReconnect(ml MessageCallback) error {
 func (al *AuthorizedListener) Listen(ml MessageCallback) error {
 	return al.Listener.Listen(al.DeviceID, al.UserSecret, ml)
 }
+
+func (al *AuthorizedListener) ListenWithReconnectContext(ctx context.Context, ml MessageCallback) error {
+	return al.Listener.ListenWithReconnectContext(ctx, al.DeviceID, al.UserSecret, ml)
+}
+
+func (al *AuthorizedListener) ListenContext(ctx context.Context, ml MessageCallback) error {
+	return al.Listener.ListenContext(ctx, al.DeviceID, al.UserSecret, ml)
+}
@@ -0,0 +1,141 @@
+package pullaway
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Middleware wraps a MessageHandler with additional behavior
+type Middleware func(next MessageHandler) MessageHandler
+
+// Chain wraps h with the given middleware, the first being the outermost
+func Chain(h MessageHandler, mw ...Middleware) MessageHandler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+
+	return h
+}
+
+// Recover turns a panic in the handler into an error
+func Recover() Middleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(m *Messages) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("panic handling message %d: %s\n%s", m.ID, DefaultRedactor.Panic(r), DefaultRedactor.Redact(string(debug.Stack())))
+				}
+			}()
+
+			return next(m)
+		}
+	}
+}
+
+// Dedupe skips messages that were among the last size handled, such as a
+// message downloaded again after deleting it failed
+func Dedupe(size int) Middleware {
+	return DedupeWith(NewMemorySeenSet(size))
+}
+
+// DedupeWith skips messages already recorded in set, recording the others
+// before they are handled
+func DedupeWith(set SeenSet) Middleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(m *Messages) error {
+			if !set.Add(dedupeKey(m)) {
+				return nil
+			}
+
+			return next(m)
+		}
+	}
+}
+
+// dedupeKey identifies a message by its Umid, unique across devices, or by
+// its account and ID when it has none
+func dedupeKey(m *Messages) string {
+	if m.Umid != 0 {
+		return "u" + strconv.FormatInt(m.Umid, 10)
+	}
+
+	return m.Account + "/" + strconv.FormatInt(m.ID, 10)
+}
+
+// RateLimit allows each app, per account, burst messages and then one more
+// every interval. Messages over the limit are skipped.
+func RateLimit(every time.Duration, burst int) Middleware {
+	type bucket struct {
+		tokens float64
+		last   time.Time
+	}
+
+	var (
+		mu      sync.Mutex
+		buckets = map[[2]string]*bucket{}
+	)
+
+	allow := func(key [2]string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+
+		now := time.Now()
+		b, ok := buckets[key]
+		if !ok {
+			b = &bucket{tokens: float64(burst), last: now}
+			buckets[key] = b
+		}
+
+		b.tokens = min(float64(burst), b.tokens+float64(now.Sub(b.last))/float64(every))
+		b.last = now
+
+		if b.tokens < 1 {
+			return false
+		}
+
+		b.tokens--
+		return true
+	}
+
+	return func(next MessageHandler) MessageHandler {
+		return func(m *Messages) error {
+			if !allow([2]string{m.Account, m.App}) {
+				return nil
+			}
+
+			return next(m)
+		}
+	}
+}
+
+// Logging logs each message handled and how long it took at debug level,
+// and handler errors at error level. l is typically a *slog.Logger.
+func Logging(l LeveledLogger) Middleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(m *Messages) error {
+			start := time.Now()
+			err := next(m)
+
+			args := []interface{}{
+				"id", m.ID,
+				"app", m.App,
+				"priority", m.Priority,
+				"duration", time.Since(start).String(),
+			}
+			if m.Account != "" {
+				args = append(args, "account", m.Account)
+			}
+
+			if err != nil {
+				l.Error("error handling message", append(args, "error", err.Error())...)
+			} else {
+				l.Debug("handled message", args...)
+			}
+
+			return err
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package pullaway
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+
+	"golang.org/x/net/proxy"
+	"golang.org/x/net/websocket"
+)
+
+// Network configures the connections made to Pushover, both by the API client
+// and by the Listener's WebSocket. A nil *Network uses the system roots and
+// the proxy environment variables.
+type Network struct {
+	// Proxy is the URL of an HTTP CONNECT ("http://", "https://") or SOCKS5
+	// ("socks5://") proxy. If nil, HTTPS_PROXY, HTTP_PROXY and NO_PROXY are
+	// used.
+	Proxy *url.URL
+	// RootCAs, if set, are trusted instead of the system roots, e.g. for a
+	// TLS-inspecting proxy
+	RootCAs *x509.CertPool
+	// Pins, if set, are base64 SHA-256 hashes of certificate public keys
+	// (SubjectPublicKeyInfo), one of which must appear in every verified chain
+	Pins []string
+
+	once   sync.Once
+	client *http.Client
+}
+
+// ErrCertificatePin is returned when no certificate in a verified chain
+// matches the configured Pins
+var ErrCertificatePin = fmt.Errorf("certificate does not match pinned keys")
+
+// PublicKeyPin returns the pin of a certificate, for use in Network.Pins
+func PublicKeyPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func (n *Network) tlsConfig(serverName string) *tls.Config {
+	c := &tls.Config{
+		ServerName: serverName,
+		RootCAs:    n.RootCAs,
+	}
+
+	if len(n.Pins) > 0 {
+		c.VerifyConnection = n.verifyPins
+	}
+
+	return c
+}
+
+func (n *Network) verifyPins(cs tls.ConnectionState) error {
+	for _, chain := range cs.VerifiedChains {
+		for _, cert := range chain {
+			if slices.Contains(n.Pins, PublicKeyPin(cert)) {
+				return nil
+			}
+		}
+	}
+
+	return ErrCertificatePin
+}
+
+func (n *Network) proxyFunc() func(*http.Request) (*url.URL, error) {
+	if n.Proxy != nil {
+		return http.ProxyURL(n.Proxy)
+	}
+
+	return http.ProxyFromEnvironment
+}
+
+// HTTPClient returns the client used for API requests. Its connections are
+// made like the WebSocket's, so pins only apply to Pushover and not to the
+// proxy.
+func (n *Network) HTTPClient() *http.Client {
+	if n == nil {
+		return &http.Client{}
+	}
+
+	n.once.Do(func() {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.Proxy = nil
+		t.DialContext = func(ctx context.Context, _, addr string) (net.Conn, error) {
+			return n.dial(ctx, "http", addr)
+		}
+		t.DialTLSContext = func(ctx context.Context, _, addr string) (net.Conn, error) {
+			return n.dial(ctx, "https", addr)
+		}
+
+		n.client = &http.Client{Transport: t}
+	})
+
+	return n.client
+}
+
+// dialWebSocket connects to the WebSocket described by config through the
+// proxy, if any, verifying TLS as configured
+func (n *Network) dialWebSocket(ctx context.Context, config *websocket.Config) (*websocket.Conn, error) {
+	if n == nil {
+		n = &Network{}
+	}
+
+	scheme := "https"
+	if config.Location.Scheme == "ws" {
+		scheme = "http"
+	}
+
+	addr := config.Location.Host
+	if config.Location.Port() == "" {
+		port := "443"
+		if scheme == "http" {
+			port = "80"
+		}
+		addr = net.JoinHostPort(config.Location.Hostname(), port)
+	}
+
+	conn, err := n.dial(ctx, scheme, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	ws, err := websocket.NewClient(config, conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return ws, nil
+}
+
+// dial connects to addr through the proxy chosen for scheme, if any. For
+// "https" the connection is wrapped in TLS verified as configured, pins
+// included, while a connection to an HTTPS proxy is verified without pins.
+func (n *Network) dial(ctx context.Context, scheme, addr string) (net.Conn, error) {
+	proxyURL, err := n.proxyFunc()(&http.Request{URL: &url.URL{Scheme: scheme, Host: addr}})
+	if err != nil {
+		return nil, fmt.Errorf("error finding proxy: %w", err)
+	}
+
+	conn, err := dialThrough(ctx, proxyURL, addr, n)
+	if err != nil {
+		return nil, err
+	}
+
+	if scheme != "https" {
+		return conn, nil
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	tlsConn := tls.Client(conn, n.tlsConfig(host))
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return tlsConn, nil
+}
+
+// dialThrough opens a TCP connection to addr, via the proxy if not nil
+func dialThrough(ctx context.Context, proxyURL *url.URL, addr string, n *Network) (net.Conn, error) {
+	d := &net.Dialer{}
+
+	if proxyURL == nil {
+		return d.DialContext(ctx, "tcp", addr)
+	}
+
+	switch proxyURL.Scheme {
+	case "socks5", "socks5h":
+		pd, err := proxy.FromURL(proxyURL, d)
+		if err != nil {
+			return nil, fmt.Errorf("error creating SOCKS5 dialer: %w", err)
+		}
+
+		if cd, ok := pd.(proxy.ContextDialer); ok {
+			return cd.DialContext(ctx, "tcp", addr)
+		}
+
+		return pd.Dial("tcp", addr)
+	case "http", "https":
+		return dialConnect(ctx, d, proxyURL, addr, n)
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+	}
+}
+
+// dialConnect tunnels to addr through an HTTP proxy with CONNECT
+func dialConnect(ctx context.Context, d *net.Dialer, proxyURL *url.URL, addr string, n *Network) (net.Conn, error) {
+	proxyAddr := proxyURL.Host
+	if proxyURL.Port() == "" {
+		port := "80"
+		if proxyURL.Scheme == "https" {
+			port = "443"
+		}
+		proxyAddr = net.JoinHostPort(proxyURL.Hostname(), port)
+	}
+
+	conn, err := d.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to proxy: %w", err)
+	}
+
+	if proxyURL.Scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: proxyURL.Hostname(), RootCAs: n.RootCAs})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("error connecting to proxy: %w", err)
+		}
+		conn = tlsConn
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+
+	if u := proxyURL.User; u != nil {
+		pass, _ := u.Password()
+		req.SetBasicAuth(u.Username(), pass)
+		req.Header.Set("Proxy-Authorization", req.Header.Get("Authorization"))
+		req.Header.Del("Authorization")
+	}
+
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+	})
+	defer stop()
+
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error sending CONNECT to proxy: %w", err)
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("error reading CONNECT response: %w", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy refused CONNECT: %s", resp.Status)
+	}
+
+	if br.Buffered() > 0 {
+		conn.Close()
+		return nil, errors.New("proxy sent data before the tunnel was established")
+	}
+
+	return conn, nil
+}
@@ -0,0 +1,170 @@
+package pullaway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrRetryWebSocket is returned by polling in ListenModeAuto when it is time
+// to try connecting to the WebSocket again
+var ErrRetryWebSocket = fmt.Errorf("retrying WebSocket")
+
+// ListenMode selects how a Listener learns of new messages
+type ListenMode int
+
+const (
+	// ListenModeWebSocket waits for notifications over the WebSocket
+	ListenModeWebSocket ListenMode = iota
+	// ListenModeAuto uses the WebSocket, falling back to polling while it
+	// cannot be connected to
+	ListenModeAuto
+	// ListenModePoll periodically downloads messages without the WebSocket
+	ListenModePoll
+)
+
+func (m ListenMode) String() string {
+	switch m {
+	case ListenModeWebSocket:
+		return "ws"
+	case ListenModeAuto:
+		return "auto"
+	case ListenModePoll:
+		return "poll"
+	default:
+		return fmt.Sprintf("ListenMode(%d)", int(m))
+	}
+}
+
+// ParseListenMode parses "ws", "auto" or "poll"
+func ParseListenMode(s string) (ListenMode, error) {
+	for _, m := range []ListenMode{ListenModeWebSocket, ListenModeAuto, ListenModePoll} {
+		if s == m.String() {
+			return m, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown listen mode %q, expected ws, auto or poll", s)
+}
+
+// PollConfig configures polling. Zero values use the defaults.
+type PollConfig struct {
+	// Interval is the time between polls after messages were found, 30s by
+	// default
+	Interval time.Duration
+	// MaxInterval is what the time between polls grows to, doubling each
+	// time no messages are found, 90s by default
+	MaxInterval time.Duration
+	// WebSocketRetry is how long ListenModeAuto polls before trying the
+	// WebSocket again, 5m by default
+	WebSocketRetry time.Duration
+}
+
+func (pc PollConfig) withDefaults() PollConfig {
+	if pc.Interval <= 0 {
+		pc.Interval = 30 * time.Second
+	}
+
+	if pc.MaxInterval < pc.Interval {
+		pc.MaxInterval = max(pc.Interval, 90*time.Second)
+	}
+
+	if pc.WebSocketRetry <= 0 {
+		pc.WebSocketRetry = 5 * time.Minute
+	}
+
+	return pc
+}
+
+// PollContext checks for messages with Client on an adaptive interval,
+// calling Polled, or ml if not set, whenever there are any, until ctx is
+// done. Each successful check is reported to Observers as a heartbeat. The
+// API rejecting the secret or device ends polling with ErrPermanentIssue.
+func (l *Listener) PollContext(ctx context.Context, deviceID string, secret string, ml MessageCallback) error {
+	return l.poll(ctx, deviceID, secret, ml, 0)
+}
+
+// poll is PollContext, returning ErrRetryWebSocket after window if non-zero
+func (l *Listener) poll(ctx context.Context, deviceID string, secret string, ml MessageCallback, window time.Duration) (err error) {
+	defer func() {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		l.notify(EventDisconnected, err)
+	}()
+
+	pc := l.Poll.withDefaults()
+
+	var deadline time.Time
+	if window > 0 {
+		deadline = time.Now().Add(window)
+	}
+
+	l.Log.Info("polling for messages", "interval", pc.Interval.String())
+
+	interval := pc.Interval
+	loggedIn := false
+	for {
+		dr, err := l.Client.downloadMessages(secret, deviceID)
+		if err != nil {
+			if isRejected(err) {
+				return errors.Join(ErrPermanentIssue, err)
+			}
+
+			l.Log.Error("error polling for messages", "error", err.Error())
+			interval = pc.MaxInterval
+		} else {
+			if !loggedIn {
+				loggedIn = true
+				l.notify(EventLoggedIn, nil)
+			}
+			l.notify(EventHeartbeat, nil)
+
+			if len(dr.Messages) > 0 {
+				l.notify(EventMessage, nil)
+
+				if l.Polled != nil {
+					err = l.Polled(dr)
+				} else {
+					err = ml()
+				}
+				if err != nil {
+					return err
+				}
+
+				interval = pc.Interval
+			} else {
+				interval = min(interval*2, pc.MaxInterval)
+			}
+		}
+
+		if !deadline.IsZero() && time.Now().Add(interval).After(deadline) {
+			if err := sleepContext(ctx, time.Until(deadline)); err != nil {
+				return err
+			}
+
+			return ErrRetryWebSocket
+		}
+
+		if err := sleepContext(ctx, interval); err != nil {
+			return err
+		}
+	}
+}
+
+// isRejected reports whether err is the API refusing the request itself,
+// such as for an invalid secret or device, which retrying will not fix
+func isRejected(err error) bool {
+	var se *StatusError
+	if !errors.As(err, &se) {
+		return false
+	}
+
+	return se.StatusCode >= 400 && se.StatusCode < 500 && se.StatusCode != http.StatusTooManyRequests
+}
+
+func (al *AuthorizedListener) PollContext(ctx context.Context, ml MessageCallback) error {
+	return al.Listener.PollContext(ctx, al.DeviceID, al.UserSecret, ml)
+}
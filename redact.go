@@ -0,0 +1,194 @@
+package pullaway
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// RedactedPlaceholder replaces secrets in redacted text
+const RedactedPlaceholder = "[REDACTED]"
+
+// minRedactLen is the shortest value redacted, so that trivially short
+// values don't mangle unrelated text
+const minRedactLen = 4
+
+// Redactor removes registered secrets from text, errors and logs
+type Redactor struct {
+	mu       sync.RWMutex
+	secrets  map[string]struct{}
+	replacer *strings.Replacer
+}
+
+// DefaultRedactor is given every user secret, device ID and password passed
+// to this package, and is used to redact the errors it returns
+var DefaultRedactor = &Redactor{}
+
+// Add registers values to be redacted. Empty and very short values are
+// ignored.
+func (r *Redactor) Add(values ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.secrets == nil {
+		r.secrets = map[string]struct{}{}
+	}
+
+	changed := false
+	for _, v := range values {
+		if len(v) < minRedactLen {
+			continue
+		}
+
+		if _, ok := r.secrets[v]; !ok {
+			r.secrets[v] = struct{}{}
+			changed = true
+		}
+	}
+
+	if !changed {
+		return
+	}
+
+	var olds []string
+	for v := range r.secrets {
+		// query encoded forms appear in request URLs
+		olds = append(olds, v)
+		if e := url.QueryEscape(v); e != v {
+			olds = append(olds, e)
+		}
+	}
+
+	// the replacer prefers earlier arguments, so longer values must come
+	// first for a secret containing another to be redacted whole
+	slices.SortFunc(olds, func(a, b string) int {
+		return cmp.Or(len(b)-len(a), strings.Compare(a, b))
+	})
+
+	var oldnew []string
+	for _, old := range olds {
+		oldnew = append(oldnew, old, RedactedPlaceholder)
+	}
+	r.replacer = strings.NewReplacer(oldnew...)
+}
+
+// Redact returns s with every registered value replaced
+func (r *Redactor) Redact(s string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.replacer == nil {
+		return s
+	}
+
+	return r.replacer.Replace(s)
+}
+
+// Error returns err with registered values removed from its message. The
+// returned error still matches err with errors.Is and errors.As. The URL of
+// any *url.Error in the chain is redacted in place.
+func (r *Redactor) Error(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		ue.URL = r.Redact(ue.URL)
+	}
+
+	msg := err.Error()
+	if red := r.Redact(msg); red != msg {
+		return &redactedError{msg: red, err: err}
+	}
+
+	return err
+}
+
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// Panic returns the message of a recovered panic value with registered
+// values removed
+func (r *Redactor) Panic(v any) string {
+	return r.Redact(fmt.Sprint(v))
+}
+
+// Handler wraps h so that registered values are removed from log messages
+// and attributes
+func (r *Redactor) Handler(h slog.Handler) slog.Handler {
+	return &redactingHandler{r: r, h: h}
+}
+
+type redactingHandler struct {
+	r *Redactor
+	h slog.Handler
+}
+
+func (rh *redactingHandler) Enabled(ctx context.Context, l slog.Level) bool {
+	return rh.h.Enabled(ctx, l)
+}
+
+func (rh *redactingHandler) Handle(ctx context.Context, rec slog.Record) error {
+	out := slog.NewRecord(rec.Time, rec.Level, rh.r.Redact(rec.Message), rec.PC)
+	rec.Attrs(func(a slog.Attr) bool {
+		out.AddAttrs(rh.attr(a))
+		return true
+	})
+
+	return rh.h.Handle(ctx, out)
+}
+
+func (rh *redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	red := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		red[i] = rh.attr(a)
+	}
+
+	return &redactingHandler{r: rh.r, h: rh.h.WithAttrs(red)}
+}
+
+func (rh *redactingHandler) WithGroup(name string) slog.Handler {
+	return &redactingHandler{r: rh.r, h: rh.h.WithGroup(name)}
+}
+
+func (rh *redactingHandler) attr(a slog.Attr) slog.Attr {
+	v := a.Value.Resolve()
+
+	switch v.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, rh.r.Redact(v.String()))
+	case slog.KindGroup:
+		group := v.Group()
+		red := make([]any, len(group))
+		for i, ga := range group {
+			red[i] = rh.attr(ga)
+		}
+		return slog.Group(a.Key, red...)
+	case slog.KindAny:
+		switch x := v.Any().(type) {
+		case error:
+			return slog.String(a.Key, rh.r.Redact(x.Error()))
+		case fmt.Stringer:
+			return slog.String(a.Key, rh.r.Redact(x.String()))
+		default:
+			s := fmt.Sprint(x)
+			if red := rh.r.Redact(s); red != s {
+				return slog.String(a.Key, red)
+			}
+		}
+	}
+
+	return slog.Attr{Key: a.Key, Value: v}
+}
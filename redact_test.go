@@ -0,0 +1,191 @@
+package pullaway
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// closedAPI returns the URL of a port nothing is listening on
+func closedAPI(t *testing.T) url.URL {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	return url.URL{Scheme: "http", Host: addr}
+}
+
+func assertRedacted(t *testing.T, s string, secrets ...string) {
+	t.Helper()
+
+	for _, secret := range secrets {
+		if strings.Contains(s, secret) {
+			t.Errorf("%q contains secret %q", s, secret)
+		}
+	}
+
+	if !strings.Contains(s, RedactedPlaceholder) {
+		t.Errorf("%q does not contain %s", s, RedactedPlaceholder)
+	}
+}
+
+func TestDownloadMessagesRedactsRequestError(t *testing.T) {
+	const secret, deviceID = "request-error-secret", "request-error-device"
+
+	_, err := DownloadMessages(closedAPI(t), secret, deviceID)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	assertRedacted(t, err.Error(), secret, deviceID)
+
+	var ue *url.Error
+	if !errors.As(err, &ue) {
+		t.Fatalf("errors.As(%v, *url.Error) failed", err)
+	}
+	assertRedacted(t, ue.URL, secret, deviceID)
+}
+
+func TestDownloadMessagesRedactsResponseBody(t *testing.T) {
+	const secret, deviceID = "response-body-secret", "response-body-device"
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"status":0,"secret":"` + r.URL.Query().Get("secret") + `"}`))
+	}))
+	defer srv.Close()
+
+	api, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = DownloadMessages(*api, secret, deviceID)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	assertRedacted(t, err.Error(), secret, deviceID)
+}
+
+func TestRedactQueryEscaped(t *testing.T) {
+	const secret = "escaped+secret/value=="
+
+	r := &Redactor{}
+	r.Add(secret)
+
+	assertRedacted(t, r.Redact("secret="+url.QueryEscape(secret)), secret, url.QueryEscape(secret))
+	assertRedacted(t, r.Redact("secret="+secret), secret)
+
+	_, err := DownloadMessages(closedAPI(t), secret, "escaped-device")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	assertRedacted(t, err.Error(), secret, url.QueryEscape(secret))
+}
+
+func TestRedactOverlappingSecrets(t *testing.T) {
+	// map order varies, so a single run could pass by chance
+	for range 20 {
+		r := &Redactor{}
+		r.Add("abcd", "abcdef")
+
+		if got := r.Redact("x abcdef y abcd"); got != "x [REDACTED] y [REDACTED]" {
+			t.Fatalf("Redact = %q, want both secrets redacted whole", got)
+		}
+	}
+}
+
+func TestRedactIgnoresShortValues(t *testing.T) {
+	r := &Redactor{}
+	r.Add("", "abc")
+
+	if got := r.Redact("abc"); got != "abc" {
+		t.Errorf("Redact(%q) = %q, want it unchanged", "abc", got)
+	}
+}
+
+func TestRedactorHandler(t *testing.T) {
+	const secret = "handler-secret"
+
+	r := &Redactor{}
+	r.Add(secret)
+
+	buf := &bytes.Buffer{}
+	l := slog.New(r.Handler(slog.NewJSONHandler(buf, nil))).
+		With("with", "with "+secret)
+
+	l.Info("message "+secret,
+		"string", secret,
+		"error", errors.New("error "+secret),
+		slog.Group("group", "nested", secret),
+		"any", []string{secret},
+	)
+
+	out := buf.String()
+	assertRedacted(t, out, secret)
+
+	for _, key := range []string{`"with"`, `"string"`, `"error"`, `"group"`, `"nested"`, `"any"`} {
+		if !strings.Contains(out, key) {
+			t.Errorf("%s missing from %s", key, out)
+		}
+	}
+}
+
+func TestRedactorHandlerWithGroup(t *testing.T) {
+	const secret = "with-group-secret"
+
+	r := &Redactor{}
+	r.Add(secret)
+
+	buf := &bytes.Buffer{}
+	slog.New(r.Handler(slog.NewTextHandler(buf, nil))).
+		WithGroup("g").
+		Info("msg", "value", secret)
+
+	assertRedacted(t, buf.String(), secret)
+}
+
+func TestRecoverRedactsPanic(t *testing.T) {
+	const secret = "recover-panic-secret"
+	DefaultRedactor.Add(secret)
+
+	h := Chain(func(m *Messages) error {
+		panic("handling with " + secret)
+	}, Recover())
+
+	err := h(&Messages{ID: 1})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	assertRedacted(t, err.Error(), secret)
+}
+
+func TestPipelineRedactsPanic(t *testing.T) {
+	const secret = "pipeline-panic-secret"
+	DefaultRedactor.Add(secret)
+
+	p := NewPipeline(nil)
+	p.Add("panics", SinkFunc(func(m *Messages) error {
+		panic(errors.New("writing with " + secret))
+	}))
+
+	err := p.Handle(&Messages{ID: 1})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	assertRedacted(t, err.Error(), secret)
+}
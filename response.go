@@ -68,6 +68,14 @@ type Messages struct {
 	DispatchedDate int    `json:"dispatched_date"`
 	URL            string `json:"url,omitempty"`
 	QueuedDate     int    `json:"queued_date,omitempty"`
+	Receipt        string `json:"receipt,omitempty"`
+
+	// Account is the name of the account the message was received on when
+	// delivered by a Supervisor. It is not part of the Pushover API response.
+	Account string `json:"account,omitempty"`
+	// QuietHours is whether the account's quiet hours were in effect when the
+	// message was downloaded. It is not part of the Pushover message.
+	QuietHours bool `json:"quiet_hours,omitempty"`
 }
 
 type User struct {
@@ -95,3 +103,7 @@ type Device struct {
 type DeleteResponse struct {
 	PushoverClientResponse
 }
+
+type AcknowledgeResponse struct {
+	PushoverClientResponse
+}
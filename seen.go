@@ -0,0 +1,184 @@
+package pullaway
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// SeenSet records which messages have been handled, for DedupeWith
+type SeenSet interface {
+	// Add records key, returning false if it had already been recorded
+	Add(key string) bool
+}
+
+// MemorySeenSet is a SeenSet remembering the most recent keys in memory
+type MemorySeenSet struct {
+	size int
+
+	mu    sync.Mutex
+	seen  map[string]struct{}
+	order []string
+}
+
+// NewMemorySeenSet creates a MemorySeenSet remembering up to size keys
+func NewMemorySeenSet(size int) *MemorySeenSet {
+	return &MemorySeenSet{
+		size: size,
+		seen: map[string]struct{}{},
+	}
+}
+
+func (s *MemorySeenSet) Add(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.add(key)
+}
+
+func (s *MemorySeenSet) add(key string) bool {
+	if _, ok := s.seen[key]; ok {
+		return false
+	}
+
+	s.seen[key] = struct{}{}
+	s.order = append(s.order, key)
+	if len(s.order) > s.size {
+		delete(s.seen, s.order[0])
+		s.order = s.order[1:]
+	}
+
+	return true
+}
+
+// FileSeenSet is a SeenSet persisted to a file, so messages are recognized
+// across restarts. The file is compacted to the most recent keys as it grows.
+type FileSeenSet struct {
+	Log LeveledLogger
+
+	*MemorySeenSet
+	path    string
+	f       *os.File
+	written int
+}
+
+// OpenFileSeenSet loads the keys recorded in the file at path, creating it if
+// needed, and remembers up to size keys
+func OpenFileSeenSet(path string, size int, l LeveledLogger) (*FileSeenSet, error) {
+	if l == nil {
+		l = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+
+	s := &FileSeenSet{
+		Log:           l,
+		MemorySeenSet: NewMemorySeenSet(size),
+		path:          path,
+	}
+
+	f, err := os.Open(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	if f != nil {
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			if key := strings.TrimSpace(sc.Text()); key != "" {
+				s.add(key)
+			}
+		}
+		f.Close()
+
+		if err := sc.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Add records key in memory and appends it to the file. Errors writing the
+// file are logged rather than returned, as the key is still remembered
+// until the process exits.
+func (s *FileSeenSet) Add(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.add(key) {
+		return false
+	}
+
+	if _, err := s.f.WriteString(key + "\n"); err != nil {
+		s.Log.Error("error recording seen message", "path", s.path, "error", err.Error())
+	}
+
+	s.written++
+	if s.written > 2*s.size {
+		if err := s.compact(); err != nil {
+			s.Log.Error("error compacting seen messages", "path", s.path, "error", err.Error())
+		}
+	}
+
+	return true
+}
+
+// compact rewrites the file with only the remembered keys
+func (s *FileSeenSet) compact() error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(tmp)
+	for _, key := range s.order {
+		w.WriteString(key + "\n")
+	}
+
+	err = w.Flush()
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	if s.f != nil {
+		s.f.Close()
+	}
+	s.f = f
+	s.written = len(s.order)
+
+	return nil
+}
+
+func (s *FileSeenSet) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.f.Close()
+}
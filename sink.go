@@ -0,0 +1,135 @@
+package pullaway
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"text/template"
+)
+
+// Sink is an output that messages are written to
+type Sink interface {
+	Write(m *Messages) error
+}
+
+// SinkFunc adapts a function, such as a MessageHandler, to a Sink
+type SinkFunc func(m *Messages) error
+
+func (f SinkFunc) Write(m *Messages) error {
+	return f(m)
+}
+
+// NewJSONSink writes each message to w as a line of JSON
+func NewJSONSink(w io.Writer) Sink {
+	return SinkFunc(func(m *Messages) error {
+		b, err := json.Marshal(m)
+		if err != nil {
+			return fmt.Errorf("error encoding JSON: %w", err)
+		}
+
+		_, err = w.Write(append(b, '\n'))
+		return err
+	})
+}
+
+// NewTextSink writes each message to w as a line of text
+func NewTextSink(w io.Writer) Sink {
+	return SinkFunc(func(m *Messages) error {
+		buf := &bytes.Buffer{}
+		if m.Account != "" {
+			fmt.Fprintf(buf, "[%s] ", m.Account)
+		}
+		fmt.Fprintf(buf, "From %s: %s - %s", m.App, m.Title, m.Message)
+		if m.URL != "" {
+			fmt.Fprintf(buf, " - URL: %s", m.URL)
+		}
+		buf.WriteByte('\n')
+
+		_, err := w.Write(buf.Bytes())
+		return err
+	})
+}
+
+// NewTemplateSink executes tmpl with each message, writing the result to w
+func NewTemplateSink(w io.Writer, tmpl *template.Template) Sink {
+	return SinkFunc(func(m *Messages) error {
+		buf := &bytes.Buffer{}
+		if err := tmpl.Execute(buf, m); err != nil {
+			return fmt.Errorf("error executing template: %w", err)
+		}
+
+		_, err := w.Write(buf.Bytes())
+		return err
+	})
+}
+
+// Pipeline fans each message out to several sinks. A sink failing or
+// panicking is logged and does not keep the message from the other sinks.
+type Pipeline struct {
+	Log LeveledLogger
+
+	sinks []namedSink
+}
+
+type namedSink struct {
+	name string
+	Sink
+}
+
+func NewPipeline(l LeveledLogger) *Pipeline {
+	if l == nil {
+		l = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+
+	return &Pipeline{
+		Log: l,
+	}
+}
+
+// Add appends a sink, named for logging
+func (p *Pipeline) Add(name string, s Sink) {
+	p.sinks = append(p.sinks, namedSink{name: name, Sink: s})
+}
+
+// Handle writes m to every sink. It returns an error only when every sink
+// failed. Handle satisfies MessageHandler.
+func (p *Pipeline) Handle(m *Messages) error {
+	var errs []error
+	for _, s := range p.sinks {
+		if err := p.write(s, m); err != nil {
+			p.Log.Error("error writing message", "sink", s.name, "id", m.ID, "error", err.Error())
+			errs = append(errs, fmt.Errorf("%s: %w", s.name, err))
+		}
+	}
+
+	if len(errs) > 0 && len(errs) == len(p.sinks) {
+		return errors.Join(errs...)
+	}
+
+	return nil
+}
+
+func (p *Pipeline) write(s namedSink, m *Messages) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %s", DefaultRedactor.Panic(r))
+		}
+	}()
+
+	return s.Write(m)
+}
+
+// Close closes every sink that is an io.Closer
+func (p *Pipeline) Close() error {
+	var errs []error
+	for _, s := range p.sinks {
+		if c, ok := s.Sink.(io.Closer); ok {
+			errs = append(errs, c.Close())
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,168 @@
+package pullaway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+)
+
+// MessageHandler is called for each individual message received
+type MessageHandler func(m *Messages) error
+
+// Supervisor listens to several accounts concurrently, each with its own
+// AuthorizedListener and reconnect state, and delivers their messages to a
+// single MessageHandler one at a time.
+type Supervisor struct {
+	Log LeveledLogger
+
+	// Observers are notified of connection state changes of every account.
+	// They must be set before Run is called.
+	Observers []AccountObserver
+
+	// Mode and Poll configure the listener of every account
+	Mode ListenMode
+	Poll PollConfig
+
+	accounts []supervisedAccount
+	mu       sync.Mutex
+}
+
+// AccountObserver is a ListenObserver that is also given the account name
+type AccountObserver func(account string, ev ListenEvent, err error)
+
+type supervisedAccount struct {
+	name string
+	ac   *AuthorizedClient
+}
+
+func NewSupervisor(l LeveledLogger) *Supervisor {
+	if l == nil {
+		l = slog.New(slog.NewTextHandler(io.Discard, nil))
+	}
+
+	return &Supervisor{
+		Log: l,
+	}
+}
+
+// Add registers an account to be listened to under the given name. The name
+// is set as the Account of every message delivered from it.
+func (s *Supervisor) Add(name string, ac *AuthorizedClient) {
+	s.accounts = append(s.accounts, supervisedAccount{name: name, ac: ac})
+}
+
+// Run listens to all added accounts and blocks until every one of them has
+// stopped with a permanent or session error. The returned error joins the
+// errors of each account.
+func (s *Supervisor) Run(h MessageHandler) error {
+	return s.RunContext(context.Background(), h)
+}
+
+// RunContext is like Run but also stops every account once ctx is done
+func (s *Supervisor) RunContext(ctx context.Context, h MessageHandler) error {
+	if len(s.accounts) == 0 {
+		return errors.New("no accounts to listen to")
+	}
+
+	errs := make([]error, len(s.accounts))
+
+	var wg sync.WaitGroup
+	for i, a := range s.accounts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() {
+				if r := recover(); r != nil {
+					errs[i] = fmt.Errorf("account %s: panic: %s", a.name, DefaultRedactor.Panic(r))
+				}
+			}()
+
+			err := s.runAccount(ctx, a, h)
+			if err != nil && ctx.Err() == nil {
+				errs[i] = fmt.Errorf("account %s: %w", a.name, err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *Supervisor) runAccount(ctx context.Context, a supervisedAccount, h MessageHandler) error {
+	log := &accountLogger{LeveledLogger: s.Log, account: a.name}
+
+	deliverDownloaded := func(dr *DownloadResponse) error {
+		if _, err := a.ac.DeleteMessages(dr.MaxID()); err != nil {
+			log.Error("error deleting messages", "error", err.Error())
+		}
+
+		for _, m := range dr.Messages {
+			m.Account = a.name
+			if err := s.deliver(h, &m); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	downloadAndDeliver := func() error {
+		dr, err := a.ac.DownloadMessages()
+		if err != nil {
+			log.Error("error fetching messages", "error", err.Error())
+			return nil
+		}
+
+		return deliverDownloaded(dr)
+	}
+
+	al := a.ac.GetAuthorizedListener(log)
+	al.Mode = s.Mode
+	al.Poll = s.Poll
+	al.Polled = deliverDownloaded
+	for _, o := range s.Observers {
+		al.Observers = append(al.Observers, func(ev ListenEvent, err error) {
+			o(a.name, ev, err)
+		})
+	}
+
+	return al.ListenWithReconnectContext(ctx, downloadAndDeliver)
+}
+
+// deliver serializes calls to the handler so accounts share one output stream
+func (s *Supervisor) deliver(h MessageHandler, m *Messages) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return h(m)
+}
+
+// accountLogger adds the account name to every log line
+type accountLogger struct {
+	LeveledLogger
+	account string
+}
+
+func (l *accountLogger) Error(msg string, args ...interface{}) {
+	l.LeveledLogger.Error(msg, append(args, "account", l.account)...)
+}
+
+func (l *accountLogger) Info(msg string, args ...interface{}) {
+	l.LeveledLogger.Info(msg, append(args, "account", l.account)...)
+}
+
+func (l *accountLogger) Debug(msg string, args ...interface{}) {
+	l.LeveledLogger.Debug(msg, append(args, "account", l.account)...)
+}
+
+func (l *accountLogger) Warn(msg string, args ...interface{}) {
+	l.LeveledLogger.Warn(msg, append(args, "account", l.account)...)
+}